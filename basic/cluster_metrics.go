@@ -0,0 +1,67 @@
+package basic
+
+// ClusterMetrics are Aurora metrics published with DBClusterIdentifier dimension only.
+//
+//nolint:lll
+var ClusterMetrics = []Metric{
+	{
+		cwName:         "AuroraGlobalDBDataTransferBytes",
+		prometheusName: "aws_rds_cluster_aurora_global_db_data_transfer_bytes_average",
+		prometheusHelp: "In an Aurora Global Database, the amount of redo log data transferred from the master AWS Region to a secondary AWS Region. Units: Bytes",
+	},
+	{
+		cwName:         "AuroraGlobalDBReplicatedWriteIO",
+		prometheusName: "aws_rds_cluster_aurora_global_db_replicated_write_io_average",
+		prometheusHelp: "In an Aurora Global Database, the number of write I/O operations replicated from the primary AWS Region to the cluster volume in a secondary AWS Region. Units: Count",
+	},
+	{
+		cwName:         "AuroraGlobalDBReplicationLag",
+		prometheusName: "aws_rds_cluster_aurora_global_db_replication_lag_average",
+		prometheusHelp: "For an Aurora Global Database, the amount of lag when replicating updates from the primary AWS Region. Units: Milliseconds",
+	},
+	{
+		cwName:         "BacktrackChangeRecordsCreationRate",
+		prometheusName: "aws_rds_cluster_backtrack_change_records_creation_rate_average",
+		prometheusHelp: "The number of backtrack change records created over 5 minutes for your DB cluster. Units: Count per 5 minutes",
+	},
+	{
+		cwName:         "BacktrackChangeRecordsStored",
+		prometheusName: "aws_rds_cluster_backtrack_change_records_stored_average",
+		prometheusHelp: "The number of backtrack change records used by your DB cluster. Units: Count",
+	},
+	{
+		cwName:         "BackupRetentionPeriodStorageUsed",
+		prometheusName: "aws_rds_cluster_backup_retention_period_storage_used_average",
+		prometheusHelp: "The total amount of backup storage used to support the point-in-time restore feature within the Aurora DB cluster's backup retention window. Units: Bytes",
+	},
+	{
+		cwName:         "ServerlessDatabaseCapacity",
+		prometheusName: "aws_rds_cluster_serverless_database_capacity_average",
+		prometheusHelp: "The current capacity of an Aurora Serverless DB cluster. Units: Count",
+	},
+	{
+		cwName:         "SnapshotStorageUsed",
+		prometheusName: "aws_rds_cluster_snapshot_storage_used_average",
+		prometheusHelp: "The total amount of backup storage consumed by all Aurora snapshots for an Aurora DB cluster outside its backup retention window. Units: Bytes",
+	},
+	{
+		cwName:         "TotalBackupStorageBilled",
+		prometheusName: "aws_rds_cluster_total_backup_storage_billed_average",
+		prometheusHelp: "The total amount of backup storage in bytes for which you are billed for a given Aurora DB cluster. Units: Bytes",
+	},
+	{
+		cwName:         "VolumeBytesUsed",
+		prometheusName: "aws_rds_cluster_volume_bytes_used_average",
+		prometheusHelp: "The amount of storage used by your Aurora DB cluster. Units: Bytes",
+	},
+	{
+		cwName:         "VolumeReadIOPs",
+		prometheusName: "aws_rds_cluster_volume_read_io_ps_average",
+		prometheusHelp: "The number of billed read I/O operations from a cluster volume within a 5-minute interval. Units: Count",
+	},
+	{
+		cwName:         "VolumeWriteIOPs",
+		prometheusName: "aws_rds_cluster_volume_write_io_ps_average",
+		prometheusHelp: "The number of write disk I/O operations to the cluster volume, reported at 5-minute intervals. Units: Count",
+	},
+}
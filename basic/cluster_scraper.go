@@ -0,0 +1,113 @@
+package basic
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/percona/rds_exporter/sessions"
+)
+
+// ClusterScraper retrieves cluster-level metrics and topology for several Aurora DB clusters sharing a single session.
+type ClusterScraper struct {
+	// params
+	clusters  []sessions.Cluster
+	collector *Collector
+	ch        chan<- prometheus.Metric
+
+	// internal
+	svc         *cloudwatch.CloudWatch
+	rdsSvc      *rds.RDS
+	constLabels map[string]prometheus.Labels // cluster -> labels
+}
+
+func NewClusterScraper(
+	session *session.Session, clusters []sessions.Cluster, collector *Collector, ch chan<- prometheus.Metric,
+) *ClusterScraper {
+	constLabels := make(map[string]prometheus.Labels, len(clusters))
+	for _, cluster := range clusters {
+		constLabels[cluster.Cluster] = makeLabels(prometheus.Labels{
+			"region": cluster.Region,
+		}, cluster.Labels)
+	}
+
+	return &ClusterScraper{
+		// params
+		clusters:  clusters,
+		collector: collector,
+		ch:        ch,
+
+		// internal
+		svc:         cloudwatch.New(session),
+		rdsSvc:      rds.New(session),
+		constLabels: constLabels,
+	}
+}
+
+// Scrape makes the required calls to AWS RDS and CloudWatch and pushes
+// cluster members and cluster-level metrics on the ch channel.
+func (s *ClusterScraper) Scrape() {
+	s.scrapeMembers()
+
+	var queries []query
+	for _, cluster := range s.clusters {
+		labels := make(prometheus.Labels, len(s.constLabels[cluster.Cluster])+1)
+		for n, v := range s.constLabels[cluster.Cluster] {
+			labels[n] = v
+		}
+		labels["cluster"] = cluster.Cluster
+
+		for _, metric := range s.collector.clusterMetricsFor(cluster.Metrics) {
+			queries = append(queries, query{
+				dimension: "DBClusterIdentifier",
+				id:        cluster.Cluster,
+				labels:    labels,
+				metric:    metric,
+			})
+		}
+	}
+
+	_, _ = scrapeQueries(context.TODO(), s.svc, queries, s.collector, "cluster", s.ch)
+}
+
+// scrapeMembers describes clusters and sends their current members.
+func (s *ClusterScraper) scrapeMembers() {
+	wanted := make(map[string]struct{}, len(s.clusters))
+	for _, cluster := range s.clusters {
+		wanted[cluster.Cluster] = struct{}{}
+	}
+
+	err := s.rdsSvc.DescribeDBClustersPages(&rds.DescribeDBClustersInput{}, func(output *rds.DescribeDBClustersOutput, lastPage bool) bool {
+		for _, dbCluster := range output.DBClusters {
+			id := aws.StringValue(dbCluster.DBClusterIdentifier)
+			if _, ok := wanted[id]; !ok {
+				continue
+			}
+
+			desc := newDesc(
+				"aws_rds_cluster_member_info",
+				"Aurora DB cluster member with its current role (writer or reader).",
+				[]string{"cluster", "instance", "role"},
+				s.constLabels[id],
+			)
+			for _, member := range dbCluster.DBClusterMembers {
+				role := "reader"
+				if aws.BoolValue(member.IsClusterWriter) {
+					role = "writer"
+				}
+				s.ch <- prometheus.MustNewConstMetric(
+					desc, prometheus.GaugeValue, 1, id, aws.StringValue(member.DBInstanceIdentifier), role,
+				)
+			}
+		}
+		return true // continue pagination
+	})
+	if err != nil {
+		s.collector.l.Errorf("Failed to describe clusters: %s.", err)
+		s.collector.health.Error("cluster", err)
+	}
+}
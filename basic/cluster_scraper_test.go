@@ -0,0 +1,51 @@
+package basic
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/percona/exporter_shared/helpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/percona/rds_exporter/client"
+	"github.com/percona/rds_exporter/config"
+	"github.com/percona/rds_exporter/fakeaws"
+	"github.com/percona/rds_exporter/sessions"
+)
+
+func TestClusterScraper(t *testing.T) {
+	server := fakeaws.New(t)
+	cfg := &config.Config{
+		Instances: []config.Instance{
+			{Region: "us-east-1", Cluster: "autotest-aurora-mysql-56-cluster", Endpoint: server.URL},
+			{Region: "us-west-2", Cluster: "autotest-aurora-psql-11-cluster", Endpoint: server.URL},
+		},
+	}
+	client := client.New()
+	sess, err := sessions.New(cfg.Instances, client.HTTP(), false)
+	require.NoError(t, err)
+	assert.Empty(t, sess.AllSessions())
+
+	c := New(cfg, sess)
+
+	actualMetrics := helpers.ReadMetrics(helpers.CollectMetrics(c))
+	sort.Slice(actualMetrics, func(i, j int) bool { return actualMetrics[i].Less(actualMetrics[j]) })
+	var actualLines []string
+	for _, line := range helpers.Format(helpers.WriteMetrics(actualMetrics)) {
+		if strings.HasPrefix(line, "aws_rds_cluster_member_info") || strings.HasPrefix(line, "aws_rds_cluster_volume_bytes_used_average") {
+			actualLines = append(actualLines, line)
+		}
+	}
+
+	expectedLines := []string{ //nolint:lll
+		`aws_rds_cluster_member_info{cluster="autotest-aurora-mysql-56-cluster",instance="autotest-aurora-mysql-56",region="us-east-1",role="writer"} 1`,
+		`aws_rds_cluster_member_info{cluster="autotest-aurora-psql-11-cluster",instance="autotest-aurora-psql-11",region="us-west-2",role="writer"} 1`,
+		`aws_rds_cluster_member_info{cluster="autotest-aurora-psql-11-cluster",instance="autotest-aurora-psql-11-reader",region="us-west-2",role="reader"} 1`,
+		`aws_rds_cluster_volume_bytes_used_average{cluster="autotest-aurora-mysql-56-cluster",region="us-east-1"} 8.552448e+07`,
+		`aws_rds_cluster_volume_bytes_used_average{cluster="autotest-aurora-psql-11-cluster",region="us-west-2"} 2.80068096e+08`,
+	}
+	assert.Equal(t, expectedLines, actualLines)
+	assert.Equal(t, 2, server.Requests("DescribeDBClusters"))
+}
@@ -1,18 +1,20 @@
 package basic
 
 import (
+	"path"
+	"strings"
 	"sync"
 	"time"
+	"unicode"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/log"
 
 	"github.com/percona/rds_exporter/config"
+	"github.com/percona/rds_exporter/health"
 	"github.com/percona/rds_exporter/sessions"
 )
 
-//go:generate go run generate/main.go generate/utils.go
-
 var (
 	scrapeTimeDesc = prometheus.NewDesc(
 		"rds_exporter_scrape_duration_seconds",
@@ -26,23 +28,200 @@ type Metric struct {
 	cwName         string
 	prometheusName string
 	prometheusHelp string
+	statistic      string  // CloudWatch statistic or extended statistic; empty for Average
+	scale          float64 // unit conversion multiplier; zero for 1
+}
+
+// stat returns CloudWatch statistic or extended statistic of the metric.
+func (m Metric) stat() string {
+	if m.statistic == "" {
+		return "Average"
+	}
+	return m.statistic
+}
+
+// withStatistic returns a copy of the metric for given CloudWatch statistic or extended statistic.
+// Prometheus name suffix "_average" (if any) is replaced by the statistic name suffix:
+// "_maximum", "_sample_count", "_p99_9", etc.
+func (m Metric) withStatistic(stat string) Metric {
+	if stat == "Average" {
+		return m
+	}
+
+	suffix, ok := statisticSuffixes[stat]
+	if !ok {
+		suffix = strings.Replace(stat, ".", "_", -1)
+	}
+	return Metric{
+		cwName:         m.cwName,
+		prometheusName: strings.TrimSuffix(m.prometheusName, "_average") + "_" + suffix,
+		prometheusHelp: m.prometheusHelp + " Statistic: " + stat + ".",
+		statistic:      stat,
+		scale:          m.scale,
+	}
+}
+
+var statisticSuffixes = map[string]string{
+	"Maximum":     "maximum",
+	"Minimum":     "minimum",
+	"Sum":         "sum",
+	"SampleCount": "sample_count",
+}
+
+// expandMetrics returns metrics for statistics configured for them.
+// Metrics without matching configuration use only Average statistic; the first matching rule is used.
+// Metrics with explicitly configured statistic are not expanded.
+func expandMetrics(metrics []Metric, rules []config.Statistics) []Metric {
+	res := make([]Metric, 0, len(metrics))
+	for _, m := range metrics {
+		if m.statistic != "" {
+			res = append(res, m)
+			continue
+		}
+
+		var rule *config.Statistics
+		for i, r := range rules {
+			if ok, _ := path.Match(r.Metric, m.cwName); ok {
+				rule = &rules[i]
+				break
+			}
+		}
+		if rule == nil {
+			res = append(res, m)
+			continue
+		}
+
+		for _, stat := range rule.Statistics {
+			res = append(res, m.withStatistic(stat))
+		}
+		for _, stat := range rule.ExtendedStatistics {
+			res = append(res, m.withStatistic(stat))
+		}
+	}
+	return res
+}
+
+// applyMetrics returns a copy of metrics with given configuration applied:
+// metrics with matching CloudWatch names are dropped or overridden, other configured metrics are added.
+func applyMetrics(metrics []Metric, cfg []config.Metric) []Metric {
+	if len(cfg) == 0 {
+		return metrics
+	}
+
+	res := make([]Metric, len(metrics), len(metrics)+len(cfg))
+	copy(res, metrics)
+	for _, c := range cfg {
+		i := 0
+		for ; i < len(res); i++ {
+			if res[i].cwName == c.CloudWatchName {
+				break
+			}
+		}
+
+		if c.Drop {
+			if i < len(res) {
+				res = append(res[:i], res[i+1:]...)
+			}
+			continue
+		}
+
+		if i == len(res) {
+			res = append(res, Metric{
+				cwName:         c.CloudWatchName,
+				prometheusName: "aws_rds_" + snakeCase(c.CloudWatchName) + "_average",
+				prometheusHelp: c.CloudWatchName,
+			})
+		}
+
+		m := res[i]
+		if c.Statistic != "" {
+			m = m.withStatistic(c.Statistic)
+			m.statistic = c.Statistic
+		}
+		if c.PrometheusName != "" {
+			m.prometheusName = c.PrometheusName
+		}
+		if c.Help != "" {
+			m.prometheusHelp = c.Help
+		}
+		if c.Scale != 0 {
+			m.scale = c.Scale
+		}
+		res[i] = m
+	}
+	return res
+}
+
+// snakeCase converts CloudWatch metric name to Prometheus metric name part:
+// "CPUUtilization" -> "cpu_utilization", "VolumeReadIOPs" -> "volume_read_io_ps", "EBSByteBalance%" -> "ebs_byte_balance".
+func snakeCase(s string) string {
+	var runes []rune
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			runes = append(runes, r)
+		}
+	}
+
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
 }
 
 type Collector struct {
-	config   *config.Config
 	sessions *sessions.Sessions
-	metrics  []Metric
+	health   *health.Tracker
 	l        log.Logger
+
+	rw             sync.RWMutex
+	config         *config.Config
+	metrics        []Metric
+	clusterMetrics []Metric
 }
 
 // New creates a new instance of a Collector.
 func New(config *config.Config, sessions *sessions.Sessions) *Collector {
-	return &Collector{
-		config:   config,
+	c := &Collector{
 		sessions: sessions,
-		metrics:  Metrics,
+		health:   health.NewTracker("basic"),
 		l:        log.With("component", "basic"),
 	}
+	c.SetConfig(config)
+	return c
+}
+
+// SetConfig replaces configuration used for the following scrapes.
+func (e *Collector) SetConfig(config *config.Config) {
+	e.rw.Lock()
+	defer e.rw.Unlock()
+
+	e.config = config
+	e.metrics = applyMetrics(Metrics, config.Metrics)
+	e.clusterMetrics = ClusterMetrics
+}
+
+// metricsFor returns metrics to scrape for instance with given metrics configuration.
+func (e *Collector) metricsFor(cfg []config.Metric) []Metric {
+	e.rw.RLock()
+	defer e.rw.RUnlock()
+
+	return expandMetrics(applyMetrics(e.metrics, cfg), e.config.Statistics)
+}
+
+// clusterMetricsFor returns metrics to scrape for cluster with given metrics configuration.
+func (e *Collector) clusterMetricsFor(cfg []config.Metric) []Metric {
+	e.rw.RLock()
+	defer e.rw.RUnlock()
+
+	return expandMetrics(applyMetrics(e.clusterMetrics, cfg), e.config.Statistics)
 }
 
 func (e *Collector) Describe(ch chan<- *prometheus.Desc) {
@@ -53,32 +232,51 @@ func (e *Collector) Collect(ch chan<- prometheus.Metric) {
 	now := time.Now()
 	e.collect(ch)
 
-	// Collect scrape time
+	// Collect scrape time and health
 	ch <- prometheus.MustNewConstMetric(scrapeTimeDesc, prometheus.GaugeValue, time.Since(now).Seconds())
+	e.health.Collect(ch)
 }
 
 func (e *Collector) collect(ch chan<- prometheus.Metric) {
 	var wg sync.WaitGroup
 	defer wg.Wait()
 
-	for _, instance := range e.config.Instances {
-		if instance.DisableBasicMetrics {
-			e.l.Debugf("Instance %s has disabled basic metrics, skipping.", instance)
+	var all []sessions.Instance
+	for session, instances := range e.sessions.AllSessions() {
+		enabled := make([]sessions.Instance, 0, len(instances))
+		for _, instance := range instances {
+			if instance.DisableBasicMetrics {
+				e.l.Debugf("Instance %s has disabled basic metrics, skipping.", instance)
+				continue
+			}
+			enabled = append(enabled, instance)
+		}
+		if len(enabled) == 0 {
 			continue
 		}
-		instance := instance
+		all = append(all, enabled...)
+
+		s := NewScraper(session, enabled, e, ch)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 
-			s := NewScraper(&instance, e, ch)
-			if s == nil {
-				e.l.Errorf("No scraper for %s, skipping.", instance)
-				return
-			}
 			s.Scrape()
 		}()
 	}
+
+	for session, clusters := range e.sessions.AllClusters() {
+		s := NewClusterScraper(session, clusters, e, ch)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			s.Scrape()
+		}()
+	}
+
+	// forget removed and disabled instances
+	e.health.Retain(all)
 }
 
 // check interfaces
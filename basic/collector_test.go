@@ -1,23 +1,25 @@
 package basic
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"strings"
 	"testing"
 
 	"github.com/percona/exporter_shared/helpers"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/percona/rds_exporter/client"
 	"github.com/percona/rds_exporter/config"
+	"github.com/percona/rds_exporter/fakeaws"
 	"github.com/percona/rds_exporter/sessions"
 )
 
 func TestCollector(t *testing.T) {
-	cfg, err := config.Load("../config.tests.yml")
-	require.NoError(t, err)
+	cfg := fakeaws.New(t).LoadConfig(t, "../config.tests.yml")
 	client := client.New()
 	sess, err := sessions.New(cfg.Instances, client.HTTP(), false)
 	require.NoError(t, err)
@@ -50,8 +52,7 @@ func TestCollector(t *testing.T) {
 }
 
 func TestCollectorDisableBasicMetrics(t *testing.T) {
-	cfg, err := config.Load("../config.tests.yml")
-	require.NoError(t, err)
+	cfg := fakeaws.New(t).LoadConfig(t, "../config.tests.yml")
 	client := client.New()
 	instanceGroups := make(map[bool][]string, 2)
 	for i := range cfg.Instances {
@@ -90,3 +91,153 @@ func TestCollectorDisableBasicMetrics(t *testing.T) {
 		assert.Truef(t, hasMetricForInstance(actualLines, inst), "Did not find metrics for enabled instance %s", inst)
 	}
 }
+
+func TestExpandMetrics(t *testing.T) {
+	metrics := []Metric{
+		{cwName: "CPUUtilization", prometheusName: "aws_rds_cpu_utilization_average", prometheusHelp: "CPUUtilization"},
+		{cwName: "ReadLatency", prometheusName: "aws_rds_read_latency_average", prometheusHelp: "ReadLatency"},
+		{cwName: "ReplicaLag", prometheusName: "aws_rds_replica_lag_average", prometheusHelp: "ReplicaLag"},
+	}
+	rules := []config.Statistics{
+		{Metric: "ReplicaLag", Statistics: []string{"Maximum", "SampleCount"}},
+		{Metric: "*Lat*", Statistics: []string{"Average"}, ExtendedStatistics: []string{"p99.9"}},
+	}
+
+	expected := []Metric{ //nolint:lll
+		metrics[0],
+		metrics[1],
+		{cwName: "ReadLatency", prometheusName: "aws_rds_read_latency_p99_9", prometheusHelp: "ReadLatency Statistic: p99.9.", statistic: "p99.9"},
+		{cwName: "ReplicaLag", prometheusName: "aws_rds_replica_lag_maximum", prometheusHelp: "ReplicaLag Statistic: Maximum.", statistic: "Maximum"},
+		{cwName: "ReplicaLag", prometheusName: "aws_rds_replica_lag_sample_count", prometheusHelp: "ReplicaLag Statistic: SampleCount.", statistic: "SampleCount"},
+	}
+	assert.Equal(t, expected, expandMetrics(metrics, rules))
+	assert.Equal(t, metrics, expandMetrics(metrics, nil))
+}
+
+func TestCollectorStatistics(t *testing.T) {
+	cfg := fakeaws.New(t).LoadConfig(t, "../config.tests.yml")
+	cfg.Statistics = []config.Statistics{
+		{Metric: "DatabaseConnections", Statistics: []string{"Maximum"}, ExtendedStatistics: []string{"p99"}},
+	}
+	client := client.New()
+	sess, err := sessions.New(cfg.Instances, client.HTTP(), false)
+	require.NoError(t, err)
+
+	c := New(cfg, sess)
+
+	names := make(map[string]int)
+	for _, m := range helpers.ReadMetrics(helpers.CollectMetrics(c)) {
+		if m.Labels["instance"] == "autotest-psql-10" {
+			names[m.Name]++
+		}
+	}
+	assert.Equal(t, 1, names["aws_rds_database_connections_maximum"])
+	assert.Equal(t, 1, names["aws_rds_database_connections_p99"])
+	assert.Zero(t, names["aws_rds_database_connections_average"])
+	assert.Equal(t, 1, names["node_cpu_average"])
+}
+
+func TestApplyMetrics(t *testing.T) {
+	metrics := []Metric{
+		{cwName: "CPUUtilization", prometheusName: "node_cpu_average", prometheusHelp: "CPUUtilization"},
+		{cwName: "FreeStorageSpace", prometheusName: "node_filesystem_free_bytes", prometheusHelp: "FreeStorageSpace"},
+		{cwName: "ReplicaLag", prometheusName: "aws_rds_replica_lag", prometheusHelp: "ReplicaLag"},
+	}
+	cfg := []config.Metric{
+		{CloudWatchName: "CPUUtilization", Drop: true},
+		{CloudWatchName: "FreeStorageSpace", Help: "Free space.", Scale: 1024},
+		{CloudWatchName: "ReplicaLag", Statistic: "Maximum"},
+		{CloudWatchName: "EBSByteBalance%"},
+		{CloudWatchName: "ACUUtilization", PrometheusName: "aws_rds_acu_utilization_percent", Statistic: "p99"},
+	}
+
+	expected := []Metric{ //nolint:lll
+		{cwName: "FreeStorageSpace", prometheusName: "node_filesystem_free_bytes", prometheusHelp: "Free space.", scale: 1024},
+		{cwName: "ReplicaLag", prometheusName: "aws_rds_replica_lag_maximum", prometheusHelp: "ReplicaLag Statistic: Maximum.", statistic: "Maximum"},
+		{cwName: "EBSByteBalance%", prometheusName: "aws_rds_ebs_byte_balance_average", prometheusHelp: "EBSByteBalance%"},
+		{cwName: "ACUUtilization", prometheusName: "aws_rds_acu_utilization_percent", prometheusHelp: "ACUUtilization Statistic: p99.", statistic: "p99"},
+	}
+	actual := applyMetrics(metrics, cfg)
+	assert.Equal(t, expected, actual)
+	assert.Len(t, metrics, 3, "original slice should not be changed")
+	assert.Equal(t, "node_cpu_average", metrics[0].prometheusName, "original slice should not be changed")
+
+	// explicit statistic is not expanded
+	rules := []config.Statistics{{Metric: "*", Statistics: []string{"Minimum"}}}
+	assert.Equal(t, "aws_rds_replica_lag_maximum", expandMetrics(actual, rules)[1].prometheusName)
+}
+
+func TestSnakeCase(t *testing.T) {
+	for cw, expected := range map[string]string{
+		"CPUUtilization":           "cpu_utilization",
+		"VolumeReadIOPs":           "volume_read_io_ps",
+		"EBSByteBalance%":          "ebs_byte_balance",
+		"ReplicationSlotDiskUsage": "replication_slot_disk_usage",
+		"AuroraGlobalDBRPOLag":     "aurora_global_dbrpo_lag",
+		"NetworkReceiveThroughput": "network_receive_throughput",
+	} {
+		assert.Equal(t, expected, snakeCase(cw), cw)
+	}
+}
+
+func TestCollectorMetrics(t *testing.T) {
+	cfg := fakeaws.New(t).LoadConfig(t, "../config.tests.yml")
+	cfg.Metrics = []config.Metric{
+		{CloudWatchName: "CPUUtilization", Drop: true},
+		{CloudWatchName: "FreeableMemory", PrometheusName: "aws_rds_freeable_memory_kilobytes", Scale: 1.0 / 1024},
+	}
+	cfg.Instances[1].Metrics = []config.Metric{
+		{CloudWatchName: "DatabaseConnections", Drop: true},
+	}
+	client := client.New()
+	sess, err := sessions.New(cfg.Instances, client.HTTP(), false)
+	require.NoError(t, err)
+
+	c := New(cfg, sess)
+
+	values := make(map[string]map[string]float64)
+	for _, m := range helpers.ReadMetrics(helpers.CollectMetrics(c)) {
+		if values[m.Labels["instance"]] == nil {
+			values[m.Labels["instance"]] = make(map[string]float64)
+		}
+		values[m.Labels["instance"]][m.Name] = m.Value
+	}
+
+	for _, instance := range []string{"autotest-aurora-mysql-56", "autotest-psql-10"} {
+		assert.NotContains(t, values[instance], "node_cpu_average", instance)
+		assert.NotContains(t, values[instance], "node_memory_Cached_bytes", instance)
+	}
+	assert.Equal(t, 814383104.0/1024, values["autotest-aurora-mysql-56"]["aws_rds_freeable_memory_kilobytes"])
+	assert.Contains(t, values["autotest-aurora-mysql-56"], "aws_rds_database_connections_average")
+	assert.NotContains(t, values["autotest-psql-10"], "aws_rds_database_connections_average")
+}
+
+func TestInstanceCollector(t *testing.T) {
+	cfg := fakeaws.New(t).LoadConfig(t, "../config.tests.yml")
+	client := client.New()
+	sess, err := sessions.New(cfg.Instances, client.HTTP(), false)
+	require.NoError(t, err)
+
+	c := New(cfg, sess)
+	assert.Nil(t, c.InstanceCollector(context.Background(), "us-west-2", "no-such-instance"))
+	assert.Nil(t, c.InstanceCollector(context.Background(), "us-east-1", "autotest-mysql-57"))
+
+	ic := c.InstanceCollector(context.Background(), "us-west-2", "autotest-mysql-57")
+	require.NotNil(t, ic)
+	instances := make(map[string]struct{})
+	for _, m := range helpers.ReadMetrics(helpers.CollectMetrics(ic)) {
+		if m.Name != "rds_exporter_scrape_duration_seconds" {
+			instances[m.Labels["instance"]] = struct{}{}
+		}
+	}
+	assert.Equal(t, map[string]struct{}{"autotest-mysql-57": {}}, instances)
+
+	// cancelled context makes collection fail
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ic = c.InstanceCollector(ctx, "us-west-2", "autotest-mysql-57")
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(ic)
+	_, err = registry.Gather()
+	assert.Error(t, err)
+}
@@ -0,0 +1,51 @@
+package basic
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/percona/rds_exporter/sessions"
+)
+
+// gib is a number of bytes in GiB, the unit of RDS allocated storage.
+const gib = 1 << 30
+
+// mib is a number of bytes in MiB, the unit of RDS storage throughput.
+const mib = 1 << 20
+
+// sendInfo sends instance metadata metrics with given constant labels.
+// Constant labels with the same names as metadata labels are not added to aws_rds_instance_info.
+func sendInfo(instance sessions.Instance, constLabels prometheus.Labels, ch chan<- prometheus.Metric) {
+	info := instance.Info
+
+	desc := newDesc(
+		"aws_rds_instance_info",
+		"RDS instance metadata.",
+		[]string{"engine", "engine_version", "instance_class", "availability_zone", "multi_az", "storage_type", "parameter_group"},
+		constLabels,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		desc, prometheus.GaugeValue, 1,
+		instance.Engine, info.EngineVersion, info.InstanceClass, info.AvailabilityZone,
+		strconv.FormatBool(info.MultiAZ), info.StorageType, info.ParameterGroup,
+	)
+
+	gauge := func(name, help string, value float64) {
+		desc := prometheus.NewDesc(name, help, nil, constLabels)
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value)
+	}
+	gauge("aws_rds_instance_allocated_storage_bytes", "Allocated storage size.", float64(info.AllocatedStorage*gib))
+	gauge("aws_rds_instance_backup_retention_period_seconds", "Automated backups retention period.",
+		float64(info.BackupRetentionPeriod*24*3600))
+	if info.MaxAllocatedStorage > 0 {
+		gauge("aws_rds_instance_max_allocated_storage_bytes", "Upper limit of storage autoscaling.", float64(info.MaxAllocatedStorage*gib))
+	}
+	if info.IOPS > 0 {
+		gauge("aws_rds_instance_provisioned_iops", "Provisioned IOPS.", float64(info.IOPS))
+	}
+	if info.StorageThroughput > 0 {
+		gauge("aws_rds_instance_storage_throughput_bytes_per_second", "Provisioned storage throughput.",
+			float64(info.StorageThroughput*mib))
+	}
+}
@@ -0,0 +1,79 @@
+package basic
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/percona/exporter_shared/helpers"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/percona/rds_exporter/client"
+	"github.com/percona/rds_exporter/fakeaws"
+	"github.com/percona/rds_exporter/sessions"
+)
+
+func TestSendInfo(t *testing.T) {
+	instance := sessions.Instance{
+		Region:   "us-west-2",
+		Instance: "autotest-mysql-57",
+		Engine:   "mysql",
+		Info: sessions.InstanceInfo{
+			EngineVersion:         "5.7.22",
+			InstanceClass:         "db.t2.micro",
+			AvailabilityZone:      "us-west-2a",
+			MultiAZ:               true,
+			StorageType:           "io1",
+			ParameterGroup:        "default.mysql5.7",
+			AllocatedStorage:      100,
+			IOPS:                  1000,
+			BackupRetentionPeriod: 7,
+		},
+	}
+
+	ch := make(chan prometheus.Metric, 10)
+	sendInfo(instance, prometheus.Labels{"region": instance.Region, "instance": instance.Instance}, ch)
+	close(ch)
+
+	var metrics []prometheus.Metric
+	for m := range ch {
+		metrics = append(metrics, m)
+	}
+	actual := helpers.Format(helpers.WriteMetrics(helpers.ReadMetrics(metrics)))
+	expected := []string{ //nolint:lll
+		`# HELP aws_rds_instance_allocated_storage_bytes Allocated storage size.`,
+		`# TYPE aws_rds_instance_allocated_storage_bytes gauge`,
+		`aws_rds_instance_allocated_storage_bytes{instance="autotest-mysql-57",region="us-west-2"} 1.073741824e+11`,
+		`# HELP aws_rds_instance_backup_retention_period_seconds Automated backups retention period.`,
+		`# TYPE aws_rds_instance_backup_retention_period_seconds gauge`,
+		`aws_rds_instance_backup_retention_period_seconds{instance="autotest-mysql-57",region="us-west-2"} 604800`,
+		`# HELP aws_rds_instance_info RDS instance metadata.`,
+		`# TYPE aws_rds_instance_info gauge`,
+		`aws_rds_instance_info{availability_zone="us-west-2a",engine="mysql",engine_version="5.7.22",instance="autotest-mysql-57",instance_class="db.t2.micro",multi_az="true",parameter_group="default.mysql5.7",region="us-west-2",storage_type="io1"} 1`,
+		`# HELP aws_rds_instance_provisioned_iops Provisioned IOPS.`,
+		`# TYPE aws_rds_instance_provisioned_iops gauge`,
+		`aws_rds_instance_provisioned_iops{instance="autotest-mysql-57",region="us-west-2"} 1000`,
+	}
+	assert.Equal(t, expected, actual)
+}
+
+func TestSendInfoLabels(t *testing.T) {
+	cfg := fakeaws.New(t).LoadConfig(t, "../config.tests.yml")
+	cfg.Instances[2].Labels = map[string]string{"engine": "custom", "storage_type": "fast"}
+	sess, err := sessions.New(cfg.Instances[2:3], client.New().HTTP(), false)
+	require.NoError(t, err)
+
+	// user labels with the same names as metadata labels do not make metrics invalid
+	var actual []string
+	for _, m := range helpers.ReadMetrics(helpers.CollectMetrics(New(cfg, sess))) {
+		if m.Name == "aws_rds_instance_info" {
+			actual = append(actual, m.Labels["engine"]+" "+m.Labels["storage_type"])
+		}
+		if m.Name == "aws_rds_instance_allocated_storage_bytes" {
+			actual = append(actual, m.Labels["engine"])
+		}
+	}
+	sort.Strings(actual)
+	assert.Equal(t, []string{"custom", "mysql io1"}, actual)
+}
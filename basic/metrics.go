@@ -1,5 +1,7 @@
 package basic
 
+// Metrics is the built-in list of basic metrics.
+// It can be changed by global and per-instance "metrics" configuration sections.
 var Metrics = []Metric{
 	{
 		cwName:         "ActiveTransactions",
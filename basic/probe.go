@@ -0,0 +1,64 @@
+package basic
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/percona/rds_exporter/sessions"
+)
+
+var probeErrorDesc = prometheus.NewDesc(
+	"rds_exporter_probe_error",
+	"Basic metrics probe error.",
+	nil,
+	nil,
+)
+
+// instanceCollector scrapes basic metrics of a single instance.
+type instanceCollector struct {
+	ctx      context.Context
+	c        *Collector
+	session  *session.Session
+	instance sessions.Instance
+}
+
+// InstanceCollector returns a collector that scrapes basic metrics of a single instance on each collection,
+// or nil if given instance is not monitored or has disabled basic metrics.
+// Collection fails if any CloudWatch request fails.
+func (e *Collector) InstanceCollector(ctx context.Context, region, instance string) prometheus.Collector {
+	session, i := e.sessions.GetSession(region, instance)
+	if session == nil || i.DisableBasicMetrics {
+		return nil
+	}
+
+	return &instanceCollector{
+		ctx:      ctx,
+		c:        e,
+		session:  session,
+		instance: *i,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (ic *instanceCollector) Describe(ch chan<- *prometheus.Desc) {
+	// unchecked collector
+}
+
+// Collect implements prometheus.Collector.
+func (ic *instanceCollector) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+	s := NewScraper(ic.session, []sessions.Instance{ic.instance}, ic.c, ch)
+	if err := s.ScrapeContext(ic.ctx); err != nil {
+		ch <- prometheus.NewInvalidMetric(probeErrorDesc, err)
+	}
+
+	ch <- prometheus.MustNewConstMetric(scrapeTimeDesc, prometheus.GaugeValue, time.Since(now).Seconds())
+}
+
+// check interfaces
+var (
+	_ prometheus.Collector = (*instanceCollector)(nil)
+)
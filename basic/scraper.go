@@ -1,14 +1,18 @@
 package basic
 
 import (
+	"context"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatch"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
 
-	"github.com/percona/rds_exporter/config"
+	"github.com/percona/rds_exporter/sessions"
 )
 
 var (
@@ -17,40 +21,45 @@ var (
 	Range  = 600 * time.Second
 )
 
+// GetMetricData accepts up to 500 queries per request.
+// https://docs.aws.amazon.com/AmazonCloudWatch/latest/APIReference/API_GetMetricData.html
+const maxQueriesPerRequest = 500
+
+// query is a single metric for a single instance or cluster.
+type query struct {
+	dimension string // DBInstanceIdentifier or DBClusterIdentifier
+	id        string // instance or cluster identifier
+	labels    prometheus.Labels
+	metric    Metric
+}
+
+// Scraper retrieves basic metrics for several RDS instances sharing a single session.
 type Scraper struct {
 	// params
-	instance  *config.Instance
+	instances []sessions.Instance
 	collector *Collector
 	ch        chan<- prometheus.Metric
 
 	// internal
 	svc         *cloudwatch.CloudWatch
-	constLabels prometheus.Labels
+	constLabels map[string]prometheus.Labels // instance -> labels
 }
 
-func NewScraper(instance *config.Instance, collector *Collector, ch chan<- prometheus.Metric) *Scraper {
+func NewScraper(session *session.Session, instances []sessions.Instance, collector *Collector, ch chan<- prometheus.Metric) *Scraper {
 	// Create CloudWatch client
-	sess, _ := collector.sessions.GetSession(instance.Region, instance.Instance)
-	if sess == nil {
-		return nil
-	}
-	svc := cloudwatch.New(sess)
+	svc := cloudwatch.New(session)
 
-	constLabels := prometheus.Labels{
-		"region":   instance.Region,
-		"instance": instance.Instance,
-	}
-	for n, v := range instance.Labels {
-		if v == "" {
-			delete(constLabels, n)
-		} else {
-			constLabels[n] = v
-		}
+	constLabels := make(map[string]prometheus.Labels, len(instances))
+	for _, instance := range instances {
+		constLabels[instance.Instance] = makeLabels(prometheus.Labels{
+			"region":   instance.Region,
+			"instance": instance.Instance,
+		}, instance.AllLabels())
 	}
 
 	return &Scraper{
 		// params
-		instance:  instance,
+		instances: instances,
 		collector: collector,
 		ch:        ch,
 
@@ -60,86 +69,199 @@ func NewScraper(instance *config.Instance, collector *Collector, ch chan<- prome
 	}
 }
 
-func getLatestDatapoint(datapoints []*cloudwatch.Datapoint) *cloudwatch.Datapoint {
-	var latest *cloudwatch.Datapoint = nil
+// Scrape makes the required calls to AWS CloudWatch by using the parameters in the Collector.
+// Once converted into Prometheus format, the metrics are pushed on the ch channel.
+func (s *Scraper) Scrape() {
+	_ = s.ScrapeContext(context.TODO())
+}
+
+// ScrapeContext is Scrape with context. It returns the first encountered error, if any.
+func (s *Scraper) ScrapeContext(ctx context.Context) error {
+	var queries []query
+	for _, instance := range s.instances {
+		sendInfo(instance, s.constLabels[instance.Instance], s.ch)
 
-	for dp := range datapoints {
-		if latest == nil || latest.Timestamp.Before(*datapoints[dp].Timestamp) {
-			latest = datapoints[dp]
+		for _, metric := range s.collector.metricsFor(instance.Metrics) {
+			queries = append(queries, query{
+				dimension: "DBInstanceIdentifier",
+				id:        instance.Instance,
+				labels:    s.constLabels[instance.Instance],
+				metric:    metric,
+			})
 		}
 	}
 
-	return latest
+	failed, err := scrapeQueries(ctx, s.svc, queries, s.collector, "basic", s.ch)
+
+	// instance is up if all requests for its metrics were successful, even if there were no datapoints
+	for i := range s.instances {
+		if _, ok := failed[s.instances[i].Instance]; ok {
+			s.collector.health.Failure(s.instances[i])
+		} else {
+			s.collector.health.Success(s.instances[i])
+		}
+	}
+	return err
 }
 
-// Scrape makes the required calls to AWS CloudWatch by using the parameters in the Collector.
-// Once converted into Prometheus format, the metrics are pushed on the ch channel.
-func (s *Scraper) Scrape() {
+// makeLabels returns given labels with added or overridden (or removed, for empty values) user labels.
+func makeLabels(labels prometheus.Labels, userLabels map[string]string) prometheus.Labels {
+	for n, v := range userLabels {
+		if v == "" {
+			delete(labels, n)
+		} else {
+			labels[n] = v
+		}
+	}
+	return labels
+}
+
+// newDesc is prometheus.NewDesc that skips constant labels clashing with variable labels,
+// so user and tag labels can't make metric invalid.
+func newDesc(fqName, help string, variableLabels []string, constLabels prometheus.Labels) *prometheus.Desc {
+	var labels prometheus.Labels
+	for _, name := range variableLabels {
+		if _, ok := constLabels[name]; !ok {
+			continue
+		}
+		if labels == nil {
+			labels = make(prometheus.Labels, len(constLabels))
+			for n, v := range constLabels {
+				labels[n] = v
+			}
+		}
+		delete(labels, name)
+	}
+	if labels == nil {
+		labels = constLabels
+	}
+	return prometheus.NewDesc(fqName, help, variableLabels, labels)
+}
+
+// scrapeQueries makes concurrent GetMetricData requests for given queries split into batches,
+// sends metrics to ch, and returns identifiers of instances or clusters with failed queries and the first error.
+func scrapeQueries(
+	ctx context.Context, svc *cloudwatch.CloudWatch, queries []query, c *Collector, component string, ch chan<- prometheus.Metric,
+) (map[string]struct{}, error) {
 	var wg sync.WaitGroup
-	defer wg.Wait()
+	var failedM sync.Mutex
+	failed := make(map[string]struct{})
+	var firstErr error
 
-	wg.Add(len(s.collector.metrics))
-	for _, metric := range s.collector.metrics {
-		metric := metric
+	for start := 0; start < len(queries); start += maxQueriesPerRequest {
+		end := start + maxQueriesPerRequest
+		if end > len(queries) {
+			end = len(queries)
+		}
+
+		batch := queries[start:end]
+		wg.Add(1)
 		go func() {
 			defer wg.Done()
 
-			if err := s.scrapeMetric(metric); err != nil {
-				s.collector.l.With("metric", metric.cwName).Error(err)
+			if err := scrapeBatch(ctx, svc, batch, c.l, ch); err != nil {
+				c.l.With("queries", len(batch)).Error(err)
+				c.health.Error(component, err)
+
+				failedM.Lock()
+				for _, q := range batch {
+					failed[q.id] = struct{}{}
+				}
+				if firstErr == nil {
+					firstErr = err
+				}
+				failedM.Unlock()
 			}
 		}()
 	}
+	wg.Wait()
+
+	return failed, firstErr
 }
 
-func (s *Scraper) scrapeMetric(metric Metric) error {
+// scrapeBatch makes a single GetMetricData request (with pagination) for given queries.
+func scrapeBatch(ctx context.Context, svc *cloudwatch.CloudWatch, queries []query, l log.Logger, ch chan<- prometheus.Metric) error {
 	now := time.Now()
 	end := now.Add(-Delay)
 
-	params := &cloudwatch.GetMetricStatisticsInput{
-		EndTime:   aws.Time(end),
-		StartTime: aws.Time(end.Add(-Range)),
+	params := &cloudwatch.GetMetricDataInput{
+		EndTime:           aws.Time(end),
+		StartTime:         aws.Time(end.Add(-Range)),
+		ScanBy:            aws.String(cloudwatch.ScanByTimestampDescending),
+		MetricDataQueries: make([]*cloudwatch.MetricDataQuery, len(queries)),
+	}
+	for i, q := range queries {
+		params.MetricDataQueries[i] = &cloudwatch.MetricDataQuery{
+			Id: aws.String(queryID(i)),
+			MetricStat: &cloudwatch.MetricStat{
+				Metric: &cloudwatch.Metric{
+					Namespace:  aws.String("AWS/RDS"),
+					MetricName: aws.String(q.metric.cwName),
+					Dimensions: []*cloudwatch.Dimension{{
+						Name:  aws.String(q.dimension),
+						Value: aws.String(q.id),
+					}},
+				},
+				Period: aws.Int64(int64(Period.Seconds())),
+				Stat:   aws.String(q.metric.stat()),
+			},
+			ReturnData: aws.Bool(true),
+		}
+	}
 
-		Period:     aws.Int64(int64(Period.Seconds())),
-		MetricName: aws.String(metric.cwName),
-		Namespace:  aws.String("AWS/RDS"),
-		Dimensions: []*cloudwatch.Dimension{},
-		Statistics: aws.StringSlice([]string{"Average"}),
-		Unit:       nil,
+	ids := make(map[string]int, len(queries))
+	for i := range queries {
+		ids[queryID(i)] = i
 	}
 
-	params.Dimensions = append(params.Dimensions, &cloudwatch.Dimension{
-		Name:  aws.String("DBInstanceIdentifier"),
-		Value: aws.String(s.instance.Instance),
-	})
+	// Pick the latest datapoint for each query. Results are sorted newest first,
+	// and the first page with datapoints for the given query contains the latest one.
+	latest := make(map[int]float64, len(queries))
+	collectLatest := func(output *cloudwatch.GetMetricDataOutput, lastPage bool) bool {
+		for _, result := range output.MetricDataResults {
+			i, ok := ids[aws.StringValue(result.Id)]
+			if !ok {
+				l.Errorf("Unexpected query ID %q.", aws.StringValue(result.Id))
+				continue
+			}
+			if _, ok = latest[i]; ok || len(result.Values) == 0 {
+				continue
+			}
+			latest[i] = aws.Float64Value(result.Values[0])
+		}
+		return true // continue pagination
+	}
 
 	// Call CloudWatch to gather the datapoints
-	resp, err := s.svc.GetMetricStatistics(params)
-	if err != nil {
+	if err := svc.GetMetricDataPagesWithContext(ctx, params, collectLatest); err != nil {
 		return err
 	}
 
-	// There's nothing in there, don't publish the metric
-	if len(resp.Datapoints) == 0 {
-		return nil
-	}
-
-	// Pick the latest datapoint
-	dp := getLatestDatapoint(resp.Datapoints)
+	// Metrics without datapoints are not published.
+	for i, v := range latest {
+		q := queries[i]
+		if q.metric.scale != 0 {
+			v *= q.metric.scale
+		}
+		switch q.metric.cwName {
+		case "EngineUptime":
+			// "Fake EngineUptime -> node_boot_time with time.Now().Unix() - EngineUptime."
+			v = float64(time.Now().Unix() - int64(v))
+		}
 
-	// Get the metric.
-	v := aws.Float64Value(dp.Average)
-	switch metric.cwName {
-	case "EngineUptime":
-		// "Fake EngineUptime -> node_boot_time with time.Now().Unix() - EngineUptime."
-		v = float64(time.Now().Unix() - int64(v))
+		// Send metric.
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(q.metric.prometheusName, q.metric.prometheusHelp, nil, q.labels),
+			prometheus.GaugeValue,
+			v,
+		)
 	}
 
-	// Send metric.
-	s.ch <- prometheus.MustNewConstMetric(
-		prometheus.NewDesc(metric.prometheusName, metric.prometheusHelp, nil, s.constLabels),
-		prometheus.GaugeValue,
-		v,
-	)
-
 	return nil
 }
+
+// queryID returns GetMetricData query ID for given query index.
+// IDs must start with a lowercase letter.
+func queryID(i int) string {
+	return fmt.Sprintf("m%d", i)
+}
@@ -1,8 +1,14 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/prometheus/common/model"
 	"gopkg.in/yaml.v2"
 )
 
@@ -16,22 +22,75 @@ import (
 // 	MySQL       InstanceType = "mysql"
 // )
 
+// Credentials represents AWS credentials configuration of instances and discovery.
+// All fields may be empty; the default credential provider chain is used then.
+type Credentials struct {
+	AWSAccessKey            string   `yaml:"aws_access_key"`
+	AWSSecretKey            string   `yaml:"aws_secret_key"`
+	AWSProfile              string   `yaml:"aws_profile"`                 // named profile from shared configuration files
+	AWSWebIdentityTokenFile string   `yaml:"aws_web_identity_token_file"` // used to assume the first role
+	AWSRoleArn              string   `yaml:"aws_role_arn"`
+	AWSRoleArns             []string `yaml:"aws_role_arns"`         // role chain assumed after aws_role_arn, if any
+	AWSExternalID           string   `yaml:"aws_external_id"`       // used to assume the last role
+	AWSRoleSessionName      string   `yaml:"aws_role_session_name"` // used to assume all roles
+}
+
+// Roles returns all roles to assume in order.
+func (c Credentials) Roles() []string {
+	var res []string
+	if c.AWSRoleArn != "" {
+		res = append(res, c.AWSRoleArn)
+	}
+	return append(res, c.AWSRoleArns...)
+}
+
+// validate checks that credentials configuration is consistent.
+func (c Credentials) validate() error {
+	static := c.AWSAccessKey != "" || c.AWSSecretKey != ""
+	if static && c.AWSProfile != "" {
+		return fmt.Errorf("aws_profile can't be used with aws_access_key and aws_secret_key")
+	}
+	if c.AWSWebIdentityTokenFile != "" {
+		if static || c.AWSProfile != "" {
+			return fmt.Errorf("aws_web_identity_token_file can't be used with aws_access_key, aws_secret_key, or aws_profile")
+		}
+		if len(c.Roles()) == 0 {
+			return fmt.Errorf("aws_web_identity_token_file requires aws_role_arn or aws_role_arns")
+		}
+		if c.AWSExternalID != "" && len(c.Roles()) == 1 {
+			// AssumeRoleWithWebIdentity does not accept external ID
+			return fmt.Errorf("aws_external_id can't be used with aws_web_identity_token_file and a single role")
+		}
+	}
+	if (c.AWSExternalID != "" || c.AWSRoleSessionName != "") && len(c.Roles()) == 0 {
+		return fmt.Errorf("aws_external_id and aws_role_session_name require aws_role_arn or aws_role_arns")
+	}
+	return nil
+}
+
 // Instance represents a single RDS information from configuration file.
+// It describes either a DB instance or an Aurora DB cluster.
 type Instance struct {
 	Region                 string            `yaml:"region"`
-	Instance               string            `yaml:"instance"`
-	AWSAccessKey           string            `yaml:"aws_access_key"` // may be empty
-	AWSSecretKey           string            `yaml:"aws_secret_key"` // may be empty
-	AWSRoleArn             string            `yaml:"aws_role_arn"`   // may be empty
+	Instance               string            `yaml:"instance"` // empty for clusters
+	Cluster                string            `yaml:"cluster"`  // empty for instances
+	Endpoint               string            `yaml:"endpoint"` // may be empty; used for tests
 	DisableBasicMetrics    bool              `yaml:"disable_basic_metrics"`
 	DisableEnhancedMetrics bool              `yaml:"disable_enhanced_metrics"`
-	Labels                 map[string]string `yaml:"labels"` // may be empty
+	Labels                 map[string]string `yaml:"labels"`     // may be empty
+	TagLabels              []string          `yaml:"tag_labels"` // RDS tag keys exposed as labels; may be empty
+	Metrics                []Metric          `yaml:"metrics"`    // may be empty
+
+	Credentials `yaml:",inline"`
 
 	// TODO Type InstanceType `yaml:"type"` // may be empty for old pmm-managed
 }
 
 func (i Instance) String() string {
 	res := i.Region + "/" + i.Instance
+	if i.Cluster != "" {
+		res = i.Region + "/cluster/" + i.Cluster
+	}
 	if i.AWSAccessKey != "" {
 		res += " (" + i.AWSAccessKey + ")"
 	}
@@ -39,9 +98,132 @@ func (i Instance) String() string {
 	return res
 }
 
+// Discovery represents automatic RDS instances discovery configuration.
+type Discovery struct {
+	Regions                []string          `yaml:"regions"`
+	Interval               time.Duration     `yaml:"interval"`       // may be empty
+	Endpoint               string            `yaml:"endpoint"`       // may be empty; used for tests
+	IncludeTags            map[string]string `yaml:"include_tags"`   // tag key => value regexp; may be empty
+	ExcludeTags            map[string]string `yaml:"exclude_tags"`   // tag key => value regexp; may be empty
+	EngineRegex            string            `yaml:"engine_regex"`   // may be empty
+	InstanceRegex          string            `yaml:"instance_regex"` // may be empty
+	DisableBasicMetrics    bool              `yaml:"disable_basic_metrics"`
+	DisableEnhancedMetrics bool              `yaml:"disable_enhanced_metrics"`
+	Labels                 map[string]string `yaml:"labels"`     // may be empty
+	TagLabels              []string          `yaml:"tag_labels"` // RDS tag keys exposed as labels; may be empty
+
+	Credentials `yaml:",inline"`
+}
+
+// Metric adds, drops or overrides a single basic metric, identified by CloudWatch metric name.
+type Metric struct {
+	CloudWatchName string  `yaml:"cloudwatch_name"`
+	PrometheusName string  `yaml:"prometheus_name"` // may be empty for default or derived name
+	Help           string  `yaml:"help"`            // may be empty
+	Statistic      string  `yaml:"statistic"`       // may be empty for Average
+	Scale          float64 `yaml:"scale"`           // unit conversion multiplier; may be empty for 1
+	Drop           bool    `yaml:"drop"`
+}
+
+// Statistics represents CloudWatch statistics fetched for basic metrics matching a name or glob pattern.
+type Statistics struct {
+	Metric             string   `yaml:"metric"`              // CloudWatch metric name or glob pattern like "*Latency"
+	Statistics         []string `yaml:"statistics"`          // Average, Maximum, Minimum, Sum, SampleCount
+	ExtendedStatistics []string `yaml:"extended_statistics"` // percentiles like p99 or p99.9
+}
+
 // Config contains configuration file information.
 type Config struct {
-	Instances []Instance `yaml:"instances"`
+	Instances  []Instance   `yaml:"instances"`
+	Discovery  *Discovery   `yaml:"discovery"`  // may be nil
+	Statistics []Statistics `yaml:"statistics"` // may be empty; only Average is fetched by default
+	Metrics    []Metric     `yaml:"metrics"`    // may be empty; applied to built-in basic metrics list
+}
+
+// statistics contains valid CloudWatch statistics.
+var statistics = map[string]struct{}{
+	"Average":     {},
+	"Maximum":     {},
+	"Minimum":     {},
+	"Sum":         {},
+	"SampleCount": {},
+}
+
+// extendedStatisticRE matches valid CloudWatch percentiles.
+var extendedStatisticRE = regexp.MustCompile(`^p(100|\d{1,2}(\.\d+)?)$`)
+
+// invalidLabelCharsRE matches characters that are not allowed in label names.
+var invalidLabelCharsRE = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// variableLabels contains names of labels with per-series values in metrics of instances
+// (aws_rds_instance_info, enhanced metrics); configured and tag labels can't use them.
+var variableLabels = map[string]struct{}{
+	"engine": {}, "engine_version": {}, "instance_class": {}, "availability_zone": {},
+	"multi_az": {}, "storage_type": {}, "parameter_group": {},
+	"cpu": {}, "core": {}, "mode": {}, "device": {}, "fstype": {}, "mountpoint": {}, "mount_point": {},
+	"interface": {}, "nic": {}, "volume": {}, "name": {}, "rank": {}, "id": {}, "parentID": {}, "tgid": {},
+}
+
+// reservedTagLabels contains label names set by the exporter itself in addition to variableLabels;
+// configured labels may override them, but tags can't.
+var reservedTagLabels = map[string]struct{}{
+	"instance":    {},
+	"region":      {},
+	"resource_id": {},
+}
+
+// TagLabelName returns label name for given RDS tag key:
+// invalid characters are replaced with underscores, and leading digit is prefixed with underscore.
+func TagLabelName(key string) string {
+	name := invalidLabelCharsRE.ReplaceAllString(key, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// validateTagLabels checks that tag keys produce valid label names that do not clash with exporter's labels.
+func validateTagLabels(keys []string) error {
+	for _, key := range keys {
+		name := TagLabelName(key)
+		if name == "" || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("tag_labels: invalid tag key %q", key)
+		}
+		_, reserved := reservedTagLabels[name]
+		if _, ok := variableLabels[name]; ok || reserved {
+			return fmt.Errorf("tag_labels: tag key %q clashes with reserved label %q", key, name)
+		}
+	}
+	return nil
+}
+
+// validateLabels checks that configured labels do not clash with exporter's variable labels.
+func validateLabels(labels map[string]string) error {
+	for name := range labels {
+		if _, ok := variableLabels[name]; ok {
+			return fmt.Errorf("labels: %q label is reserved", name)
+		}
+	}
+	return nil
+}
+
+// clusterLabels contains label names set by the exporter for each cluster member.
+var clusterLabels = []string{"cluster", "instance", "role"}
+
+// validateCluster checks that cluster entry does not use instance-only options or reserved labels.
+func validateCluster(cluster Instance) error {
+	if len(cluster.TagLabels) != 0 {
+		return fmt.Errorf("tag_labels can't be used with cluster")
+	}
+	if cluster.DisableBasicMetrics || cluster.DisableEnhancedMetrics {
+		return fmt.Errorf("disable_basic_metrics and disable_enhanced_metrics can't be used with cluster")
+	}
+	for _, name := range clusterLabels {
+		if _, ok := cluster.Labels[name]; ok {
+			return fmt.Errorf("labels: %q label is reserved for clusters", name)
+		}
+	}
+	return nil
 }
 
 // Load loads configuration from file.
@@ -55,6 +237,109 @@ func Load(filename string) (*Config, error) {
 	if err = yaml.Unmarshal(b, &config); err != nil {
 		return nil, err
 	}
+	if err = config.validate(); err != nil {
+		return nil, err
+	}
 
 	return &config, nil
 }
+
+// validate checks that configuration is complete and consistent.
+func (c *Config) validate() error {
+	for i, instance := range c.Instances {
+		if instance.Region == "" || (instance.Instance == "") == (instance.Cluster == "") {
+			return fmt.Errorf("instances[%d]: region and either instance or cluster should be set", i)
+		}
+		if err := instance.Credentials.validate(); err != nil {
+			return fmt.Errorf("instances[%d]: %s", i, err)
+		}
+		if err := validateMetrics(instance.Metrics); err != nil {
+			return fmt.Errorf("instances[%d]: %s", i, err)
+		}
+		if err := validateTagLabels(instance.TagLabels); err != nil {
+			return fmt.Errorf("instances[%d]: %s", i, err)
+		}
+		if instance.Cluster != "" {
+			if err := validateCluster(instance); err != nil {
+				return fmt.Errorf("instances[%d]: %s", i, err)
+			}
+		} else {
+			if err := validateLabels(instance.Labels); err != nil {
+				return fmt.Errorf("instances[%d]: %s", i, err)
+			}
+		}
+	}
+
+	if err := validateMetrics(c.Metrics); err != nil {
+		return err
+	}
+
+	for i, s := range c.Statistics {
+		if _, err := path.Match(s.Metric, ""); s.Metric == "" || err != nil {
+			return fmt.Errorf("statistics[%d]: invalid metric pattern %q", i, s.Metric)
+		}
+		if len(s.Statistics)+len(s.ExtendedStatistics) == 0 {
+			return fmt.Errorf("statistics[%d]: at least one statistic or extended statistic should be set", i)
+		}
+		for _, stat := range s.Statistics {
+			if _, ok := statistics[stat]; !ok {
+				return fmt.Errorf("statistics[%d]: invalid statistic %q", i, stat)
+			}
+		}
+		for _, stat := range s.ExtendedStatistics {
+			if !extendedStatisticRE.MatchString(stat) {
+				return fmt.Errorf("statistics[%d]: invalid extended statistic %q", i, stat)
+			}
+		}
+	}
+
+	if d := c.Discovery; d != nil {
+		if len(d.Regions) == 0 {
+			return fmt.Errorf("discovery: at least one region should be set")
+		}
+		if err := d.Credentials.validate(); err != nil {
+			return fmt.Errorf("discovery: %s", err)
+		}
+		if err := validateTagLabels(d.TagLabels); err != nil {
+			return fmt.Errorf("discovery: %s", err)
+		}
+		if err := validateLabels(d.Labels); err != nil {
+			return fmt.Errorf("discovery: %s", err)
+		}
+		exprs := []string{d.EngineRegex, d.InstanceRegex}
+		for _, expr := range d.IncludeTags {
+			exprs = append(exprs, expr)
+		}
+		for _, expr := range d.ExcludeTags {
+			exprs = append(exprs, expr)
+		}
+		for _, expr := range exprs {
+			if _, err := regexp.Compile(expr); err != nil {
+				return fmt.Errorf("discovery: %s", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateMetrics checks basic metrics configuration.
+func validateMetrics(metrics []Metric) error {
+	for i, m := range metrics {
+		if m.CloudWatchName == "" {
+			return fmt.Errorf("metrics[%d]: cloudwatch_name should be set", i)
+		}
+		if m.PrometheusName != "" && !model.IsValidMetricName(model.LabelValue(m.PrometheusName)) {
+			return fmt.Errorf("metrics[%d]: invalid prometheus_name %q", i, m.PrometheusName)
+		}
+		if m.Statistic != "" {
+			if _, ok := statistics[m.Statistic]; !ok && !extendedStatisticRE.MatchString(m.Statistic) {
+				return fmt.Errorf("metrics[%d]: invalid statistic %q", i, m.Statistic)
+			}
+		}
+		if m.Scale < 0 {
+			return fmt.Errorf("metrics[%d]: scale should not be negative", i)
+		}
+	}
+	return nil
+}
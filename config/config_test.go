@@ -0,0 +1,216 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagLabelName(t *testing.T) {
+	for key, expected := range map[string]string{
+		"team":                          "team",
+		"1st-line":                      "_1st_line",
+		"aws:cloudformation:stack-name": "aws_cloudformation_stack_name",
+		"":                              "",
+	} {
+		assert.Equal(t, expected, TagLabelName(key), "%q", key)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rds_exporter_config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	load := func(t *testing.T, data string) (*Config, error) {
+		t.Helper()
+
+		filename := filepath.Join(dir, "config.yml")
+		require.NoError(t, ioutil.WriteFile(filename, []byte(data), 0600))
+		return Load(filename)
+	}
+
+	t.Run("Tests", func(t *testing.T) {
+		cfg, err := Load("../config.tests.yml")
+		require.NoError(t, err)
+		assert.Len(t, cfg.Instances, 5)
+		assert.Nil(t, cfg.Discovery)
+	})
+
+	t.Run("NoInstance", func(t *testing.T) {
+		_, err := load(t, "instances:\n  - region: us-east-1\n")
+		assert.EqualError(t, err, "instances[0]: region and either instance or cluster should be set")
+	})
+
+	t.Run("InstanceAndCluster", func(t *testing.T) {
+		_, err := load(t, "instances:\n  - region: us-east-1\n    instance: db1\n    cluster: cluster1\n")
+		assert.EqualError(t, err, "instances[0]: region and either instance or cluster should be set")
+	})
+
+	t.Run("Cluster", func(t *testing.T) {
+		cfg, err := load(t, "instances:\n  - region: us-east-1\n    cluster: cluster1\n")
+		require.NoError(t, err)
+		require.Len(t, cfg.Instances, 1)
+		assert.Equal(t, "cluster1", cfg.Instances[0].Cluster)
+		assert.Equal(t, "us-east-1/cluster/cluster1", cfg.Instances[0].String())
+
+		_, err = load(t, "instances:\n  - region: us-east-1\n    cluster: cluster1\n    labels:\n      role: aurora\n")
+		assert.EqualError(t, err, `instances[0]: labels: "role" label is reserved for clusters`)
+
+		_, err = load(t, "instances:\n  - region: us-east-1\n    cluster: cluster1\n    tag_labels: [team]\n")
+		assert.EqualError(t, err, "instances[0]: tag_labels can't be used with cluster")
+
+		_, err = load(t, "instances:\n  - region: us-east-1\n    cluster: cluster1\n    disable_basic_metrics: true\n")
+		assert.EqualError(t, err, "instances[0]: disable_basic_metrics and disable_enhanced_metrics can't be used with cluster")
+	})
+
+	t.Run("Statistics", func(t *testing.T) {
+		cfg, err := load(t, "statistics:\n  - metric: \"*Latency\"\n    statistics: [Maximum]\n    extended_statistics: [p99, p99.9]\n")
+		require.NoError(t, err)
+		expected := []Statistics{{
+			Metric:             "*Latency",
+			Statistics:         []string{"Maximum"},
+			ExtendedStatistics: []string{"p99", "p99.9"},
+		}}
+		assert.Equal(t, expected, cfg.Statistics)
+
+		_, err = load(t, "statistics:\n  - metric: ReplicaLag\n    statistics: [Max]\n")
+		assert.EqualError(t, err, `statistics[0]: invalid statistic "Max"`)
+
+		_, err = load(t, "statistics:\n  - metric: ReplicaLag\n    extended_statistics: [99]\n")
+		assert.EqualError(t, err, `statistics[0]: invalid extended statistic "99"`)
+
+		_, err = load(t, "statistics:\n  - metric: \"[\"\n    statistics: [Maximum]\n")
+		assert.EqualError(t, err, `statistics[0]: invalid metric pattern "["`)
+
+		_, err = load(t, "statistics:\n  - metric: ReplicaLag\n")
+		assert.EqualError(t, err, "statistics[0]: at least one statistic or extended statistic should be set")
+	})
+
+	t.Run("Metrics", func(t *testing.T) {
+		cfg, err := load(t, `
+metrics:
+  - cloudwatch_name: ServerlessDatabaseCapacity
+  - cloudwatch_name: CPUUtilization
+    drop: true
+instances:
+  - region: us-east-1
+    instance: db1
+    metrics:
+      - cloudwatch_name: FreeableMemory
+        prometheus_name: aws_rds_freeable_memory_megabytes
+        help: Freeable memory.
+        statistic: Minimum
+        scale: 0.00000095367431640625
+`)
+		require.NoError(t, err)
+		assert.Equal(t, []Metric{{CloudWatchName: "ServerlessDatabaseCapacity"}, {CloudWatchName: "CPUUtilization", Drop: true}}, cfg.Metrics)
+		expected := []Metric{{
+			CloudWatchName: "FreeableMemory",
+			PrometheusName: "aws_rds_freeable_memory_megabytes",
+			Help:           "Freeable memory.",
+			Statistic:      "Minimum",
+			Scale:          1.0 / 1024 / 1024,
+		}}
+		assert.Equal(t, expected, cfg.Instances[0].Metrics)
+
+		_, err = load(t, "metrics:\n  - prometheus_name: foo\n")
+		assert.EqualError(t, err, "metrics[0]: cloudwatch_name should be set")
+
+		_, err = load(t, "metrics:\n  - cloudwatch_name: Foo\n    prometheus_name: foo-bar\n")
+		assert.EqualError(t, err, `metrics[0]: invalid prometheus_name "foo-bar"`)
+
+		_, err = load(t, "instances:\n  - region: us-east-1\n    instance: db1\n"+
+			"    metrics:\n      - cloudwatch_name: Foo\n        statistic: Max\n")
+		assert.EqualError(t, err, `instances[0]: metrics[0]: invalid statistic "Max"`)
+	})
+
+	t.Run("Credentials", func(t *testing.T) {
+		cfg, err := load(t, `
+instances:
+  - region: us-east-1
+    instance: db1
+    aws_web_identity_token_file: /var/run/secrets/eks.amazonaws.com/serviceaccount/token
+    aws_role_arn: arn:aws:iam::123456789012:role/first
+    aws_role_arns: [arn:aws:iam::210987654321:role/second]
+    aws_external_id: external
+    aws_role_session_name: rds_exporter
+discovery:
+  regions: [us-east-1]
+  aws_profile: prod
+`)
+		require.NoError(t, err)
+		expected := Credentials{
+			AWSWebIdentityTokenFile: "/var/run/secrets/eks.amazonaws.com/serviceaccount/token",
+			AWSRoleArn:              "arn:aws:iam::123456789012:role/first",
+			AWSRoleArns:             []string{"arn:aws:iam::210987654321:role/second"},
+			AWSExternalID:           "external",
+			AWSRoleSessionName:      "rds_exporter",
+		}
+		assert.Equal(t, expected, cfg.Instances[0].Credentials)
+		roles := []string{"arn:aws:iam::123456789012:role/first", "arn:aws:iam::210987654321:role/second"}
+		assert.Equal(t, roles, expected.Roles())
+		assert.Equal(t, Credentials{AWSProfile: "prod"}, cfg.Discovery.Credentials)
+
+		_, err = load(t, "instances:\n  - region: us-east-1\n    instance: db1\n    aws_web_identity_token_file: /token\n")
+		assert.EqualError(t, err, "instances[0]: aws_web_identity_token_file requires aws_role_arn or aws_role_arns")
+
+		_, err = load(t, "instances:\n  - region: us-east-1\n    instance: db1\n    aws_web_identity_token_file: /token\n"+
+			"    aws_role_arn: arn:aws:iam::123456789012:role/first\n    aws_external_id: external\n")
+		assert.EqualError(t, err, "instances[0]: aws_external_id can't be used with aws_web_identity_token_file and a single role")
+
+		_, err = load(t, "discovery:\n  regions: [us-east-1]\n  aws_profile: prod\n  aws_access_key: AKIAFAKE\n")
+		assert.EqualError(t, err, "discovery: aws_profile can't be used with aws_access_key and aws_secret_key")
+
+		_, err = load(t, "instances:\n  - region: us-east-1\n    instance: db1\n    aws_external_id: external\n")
+		assert.EqualError(t, err, "instances[0]: aws_external_id and aws_role_session_name require aws_role_arn or aws_role_arns")
+	})
+
+	t.Run("TagLabels", func(t *testing.T) {
+		cfg, err := load(t, "instances:\n  - region: us-east-1\n    instance: db1\n    tag_labels: [team, cost-center]\n")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"team", "cost-center"}, cfg.Instances[0].TagLabels)
+
+		_, err = load(t, "instances:\n  - region: us-east-1\n    instance: db1\n    tag_labels: [team, Instance, instance]\n")
+		assert.EqualError(t, err, `instances[0]: tag_labels: tag key "instance" clashes with reserved label "instance"`)
+
+		_, err = load(t, "discovery:\n  regions: [us-east-1]\n  tag_labels: [resource-id]\n")
+		assert.EqualError(t, err, `discovery: tag_labels: tag key "resource-id" clashes with reserved label "resource_id"`)
+
+		_, err = load(t, "discovery:\n  regions: [us-east-1]\n  tag_labels: [\"__name__\"]\n")
+		assert.EqualError(t, err, `discovery: tag_labels: invalid tag key "__name__"`)
+
+		// tag keys that are sanitized to labels of enhanced metrics
+		_, err = load(t, "instances:\n  - region: us-east-1\n    instance: db1\n    tag_labels: [\"name\", team]\n")
+		assert.EqualError(t, err, `instances[0]: tag_labels: tag key "name" clashes with reserved label "name"`)
+
+		_, err = load(t, "instances:\n  - region: us-east-1\n    instance: db1\n    tag_labels: [\"mount-point\"]\n")
+		assert.EqualError(t, err, `instances[0]: tag_labels: tag key "mount-point" clashes with reserved label "mount_point"`)
+	})
+
+	t.Run("Labels", func(t *testing.T) {
+		cfg, err := load(t, "instances:\n  - region: us-east-1\n    instance: db1\n    labels:\n      instance: mysql\n      team: dba\n")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"instance": "mysql", "team": "dba"}, cfg.Instances[0].Labels)
+
+		_, err = load(t, "instances:\n  - region: us-east-1\n    instance: db1\n    labels:\n      device: sda\n")
+		assert.EqualError(t, err, `instances[0]: labels: "device" label is reserved`)
+
+		_, err = load(t, "discovery:\n  regions: [us-east-1]\n  labels:\n    engine: mysql\n")
+		assert.EqualError(t, err, `discovery: labels: "engine" label is reserved`)
+	})
+
+	t.Run("NoRegions", func(t *testing.T) {
+		_, err := load(t, "discovery:\n  engine_regex: mysql\n")
+		assert.EqualError(t, err, "discovery: at least one region should be set")
+	})
+
+	t.Run("InvalidRegex", func(t *testing.T) {
+		_, err := load(t, "discovery:\n  regions: [us-east-1]\n  include_tags:\n    team: \"(\"\n")
+		assert.EqualError(t, err, "discovery: error parsing regexp: missing closing ): `(`")
+	})
+}
@@ -0,0 +1,214 @@
+// Package discovery implements automatic RDS instances discovery.
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/prometheus/common/log"
+
+	"github.com/percona/rds_exporter/config"
+	"github.com/percona/rds_exporter/sessions"
+)
+
+// defaultInterval is used when discovery interval is not configured.
+const defaultInterval = 5 * time.Minute
+
+// Discoverer periodically lists RDS instances matching configured filters
+// and passes them to sessions pool.
+type Discoverer struct {
+	cfg      *config.Discovery
+	sessions *sessions.Sessions
+	svcs     map[string]*rds.RDS // region => client
+	logger   log.Logger
+
+	engine      *regexp.Regexp
+	instance    *regexp.Regexp
+	includeTags map[string]*regexp.Regexp
+	excludeTags map[string]*regexp.Regexp
+
+	found map[string][]config.Instance // region => instances found by the last successful request
+}
+
+// New creates a new Discoverer for given configuration.
+func New(cfg *config.Discovery, sess *sessions.Sessions, client *http.Client, trace bool) (*Discoverer, error) {
+	if len(cfg.Regions) == 0 {
+		return nil, fmt.Errorf("discovery: no regions configured")
+	}
+
+	d := &Discoverer{
+		cfg:      cfg,
+		sessions: sess,
+		svcs:     make(map[string]*rds.RDS, len(cfg.Regions)),
+		logger:   log.With("component", "discovery"),
+		found:    make(map[string][]config.Instance, len(cfg.Regions)),
+	}
+
+	var err error
+	if d.engine, err = compile(cfg.EngineRegex); err != nil {
+		return nil, err
+	}
+	if d.instance, err = compile(cfg.InstanceRegex); err != nil {
+		return nil, err
+	}
+	if d.includeTags, err = compileTags(cfg.IncludeTags); err != nil {
+		return nil, err
+	}
+	if d.excludeTags, err = compileTags(cfg.ExcludeTags); err != nil {
+		return nil, err
+	}
+
+	for _, region := range cfg.Regions {
+		session, err := sessions.NewSession(d.instanceFor(region, ""), client, trace)
+		if err != nil {
+			return nil, err
+		}
+		d.svcs[region] = rds.New(session)
+	}
+
+	return d, nil
+}
+
+// Run discovers instances immediately and then periodically until context is canceled.
+func (d *Discoverer) Run(ctx context.Context) {
+	interval := d.cfg.Interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	d.logger.Infof("Discovering instances in %v every %s.", d.cfg.Regions, interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		instances := d.discover(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err := d.sessions.SetDiscovered(instances); err != nil {
+			d.logger.Errorf("Failed to update sessions: %s.", err)
+		}
+
+		select {
+		case <-ticker.C:
+			// nothing
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// discover returns all matching instances in all regions.
+// Instances found in the previous run are kept for regions that failed.
+func (d *Discoverer) discover(ctx context.Context) []config.Instance {
+	regions := make([]string, 0, len(d.svcs))
+	for region := range d.svcs {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	var res []config.Instance
+	for _, region := range regions {
+		var found []config.Instance
+		collectMatching := func(output *rds.DescribeDBInstancesOutput, lastPage bool) bool {
+			for _, dbInstance := range output.DBInstances {
+				if d.match(dbInstance) {
+					found = append(found, d.instanceFor(region, aws.StringValue(dbInstance.DBInstanceIdentifier)))
+				}
+			}
+			return true // continue pagination
+		}
+		err := d.svcs[region].DescribeDBInstancesPagesWithContext(ctx, &rds.DescribeDBInstancesInput{}, collectMatching)
+		if err != nil {
+			d.logger.With("region", region).Errorf("Failed to discover instances: %s.", err)
+		} else {
+			d.found[region] = found
+		}
+
+		res = append(res, d.found[region]...)
+	}
+
+	d.logger.Debugf("Discovered %d instances.", len(res))
+	return res
+}
+
+// match returns true if given DB instance matches configured filters.
+func (d *Discoverer) match(dbInstance *rds.DBInstance) bool {
+	if d.engine != nil && !d.engine.MatchString(aws.StringValue(dbInstance.Engine)) {
+		return false
+	}
+	if d.instance != nil && !d.instance.MatchString(aws.StringValue(dbInstance.DBInstanceIdentifier)) {
+		return false
+	}
+
+	tags := make(map[string]string, len(dbInstance.TagList))
+	for _, tag := range dbInstance.TagList {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+
+	// all include filters should match
+	for key, re := range d.includeTags {
+		value, ok := tags[key]
+		if !ok || !re.MatchString(value) {
+			return false
+		}
+	}
+
+	// no exclude filter should match
+	for key, re := range d.excludeTags {
+		if value, ok := tags[key]; ok && re.MatchString(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// instanceFor returns configuration for discovered instance in given region.
+func (d *Discoverer) instanceFor(region, instance string) config.Instance {
+	return config.Instance{
+		Region:                 region,
+		Instance:               instance,
+		Credentials:            d.cfg.Credentials,
+		Endpoint:               d.cfg.Endpoint,
+		DisableBasicMetrics:    d.cfg.DisableBasicMetrics,
+		DisableEnhancedMetrics: d.cfg.DisableEnhancedMetrics,
+		Labels:                 d.cfg.Labels,
+		TagLabels:              d.cfg.TagLabels,
+	}
+}
+
+// compile returns compiled anchored regexp, or nil for empty expression.
+func compile(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("discovery: %s", err)
+	}
+	return re, nil
+}
+
+// compileTags returns compiled anchored regexps for tag filters.
+// Empty expression matches any tag value.
+func compileTags(tags map[string]string) (map[string]*regexp.Regexp, error) {
+	res := make(map[string]*regexp.Regexp, len(tags))
+	for key, expr := range tags {
+		if expr == "" {
+			expr = ".*"
+		}
+		re, err := compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		res[key] = re
+	}
+	return res, nil
+}
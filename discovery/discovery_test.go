@@ -0,0 +1,56 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/percona/rds_exporter/config"
+)
+
+func TestMatch(t *testing.T) {
+	d := &Discoverer{cfg: &config.Discovery{}}
+	var err error
+	d.engine, err = compile("aurora-.*|postgres")
+	require.NoError(t, err)
+	d.instance, err = compile("prod-.*")
+	require.NoError(t, err)
+	d.includeTags, err = compileTags(map[string]string{"team": "dba|sre", "monitoring": ""})
+	require.NoError(t, err)
+	d.excludeTags, err = compileTags(map[string]string{"env": "test"})
+	require.NoError(t, err)
+
+	dbInstance := func(engine, instance string, tags map[string]string) *rds.DBInstance {
+		res := &rds.DBInstance{
+			Engine:               aws.String(engine),
+			DBInstanceIdentifier: aws.String(instance),
+		}
+		for k, v := range tags {
+			res.TagList = append(res.TagList, &rds.Tag{Key: aws.String(k), Value: aws.String(v)})
+		}
+		return res
+	}
+
+	for _, tc := range []struct {
+		name     string
+		db       *rds.DBInstance
+		expected bool
+	}{
+		{"match", dbInstance("aurora-mysql", "prod-1", map[string]string{"team": "dba", "monitoring": "yes"}), true},
+		{"engine", dbInstance("mysql", "prod-1", map[string]string{"team": "dba", "monitoring": "yes"}), false},
+		{"engine anchored", dbInstance("postgres-custom", "prod-1", map[string]string{"team": "dba", "monitoring": "yes"}), false},
+		{"instance", dbInstance("postgres", "staging-1", map[string]string{"team": "dba", "monitoring": "yes"}), false},
+		{"include value", dbInstance("postgres", "prod-1", map[string]string{"team": "dev", "monitoring": "yes"}), false},
+		{"include missing", dbInstance("postgres", "prod-1", map[string]string{"team": "sre"}), false},
+		{"exclude", dbInstance("postgres", "prod-1", map[string]string{"team": "sre", "monitoring": "", "env": "test"}), false},
+		{"exclude other value", dbInstance("postgres", "prod-1", map[string]string{"team": "sre", "monitoring": "", "env": "prod"}), true},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, d.match(tc.db))
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package enhanced
+
+// sampleBuffer is a ring buffer of instance's latest samples.
+// When full, the oldest sample is overwritten.
+type sampleBuffer struct {
+	samples []*sample
+	start   int // index of the oldest sample
+	len     int
+}
+
+// newSampleBuffer creates a new buffer of given size.
+func newSampleBuffer(size int) *sampleBuffer {
+	return &sampleBuffer{
+		samples: make([]*sample, size),
+	}
+}
+
+// push adds sample to the buffer.
+func (b *sampleBuffer) push(s *sample) {
+	size := len(b.samples)
+	if b.len < size {
+		b.samples[(b.start+b.len)%size] = s
+		b.len++
+		return
+	}
+
+	b.samples[b.start] = s
+	b.start = (b.start + 1) % size
+}
+
+// all returns all buffered samples, oldest first. Buffer is not changed.
+func (b *sampleBuffer) all() []*sample {
+	res := make([]*sample, b.len)
+	for i := range res {
+		res[i] = b.samples[(b.start+i)%len(b.samples)]
+	}
+	return res
+}
@@ -0,0 +1,40 @@
+package enhanced
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampleBuffer(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	makeSample := func(i int) *sample {
+		return &sample{timestamp: start.Add(time.Duration(i) * time.Second)}
+	}
+	timestamps := func(samples []*sample) []int {
+		res := make([]int, len(samples))
+		for i, s := range samples {
+			res[i] = int(s.timestamp.Sub(start) / time.Second)
+		}
+		return res
+	}
+
+	b := newSampleBuffer(3)
+	assert.Empty(t, b.all())
+
+	// samples are kept after reading
+	b.push(makeSample(1))
+	b.push(makeSample(2))
+	assert.Equal(t, []int{1, 2}, timestamps(b.all()))
+	assert.Equal(t, []int{1, 2}, timestamps(b.all()))
+
+	// the oldest samples are overwritten
+	for i := 3; i <= 7; i++ {
+		b.push(makeSample(i))
+	}
+	assert.Equal(t, []int{5, 6, 7}, timestamps(b.all()))
+
+	b.push(makeSample(8))
+	assert.Equal(t, []int{6, 7, 8}, timestamps(b.all()))
+}
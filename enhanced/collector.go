@@ -2,22 +2,113 @@ package enhanced
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/log"
 
+	"github.com/percona/rds_exporter/health"
 	"github.com/percona/rds_exporter/sessions"
 )
 
+// Options configures Collector.
+type Options struct {
+	// StaleIntervals is the number of instance's Enhanced Monitoring intervals (or delivery intervals,
+	// if they are longer) after which its last sample is considered stale and its metrics are no longer exposed.
+	// Zero value means DefaultStaleIntervals.
+	StaleIntervals int
+
+	// ProcessList configures rdsosmetrics_processList_ metrics.
+	ProcessList ProcessListOptions
+
+	// Timestamps makes enhanced metrics exposed with their Enhanced Monitoring event timestamps
+	// instead of scrape timestamps.
+	Timestamps bool
+
+	// BufferSize is the number of instance's latest samples kept in a buffer.
+	// All buffered samples are exposed by every Gather call with their timestamps,
+	// so several scrapers receive the same samples.
+	// Zero value disables buffering: only the latest sample is exposed.
+	BufferSize int
+
+	// Ingestion defines how Enhanced Monitoring events are received.
+	// Zero value means IngestionPoll. With IngestionFirehose, events are received by FirehoseHandler only.
+	Ingestion IngestionMode
+
+	// FirehoseBufferInterval is the buffering interval of Kinesis Data Firehose delivery stream
+	// (with IngestionFirehose). Zero value means DefaultFirehoseBufferInterval.
+	FirehoseBufferInterval time.Duration
+}
+
+// DefaultStaleIntervals is the default value of Options.StaleIntervals.
+const DefaultStaleIntervals = 3
+
+// DefaultFirehoseBufferInterval is the default value of Options.FirehoseBufferInterval.
+const DefaultFirehoseBufferInterval = 60 * time.Second
+
+// deliveryLatency is the allowed delay between Enhanced Monitoring event and its availability in CloudWatch Logs.
+const deliveryLatency = 30 * time.Second
+
+var sampleAgeDesc = prometheus.NewDesc(
+	"rds_exporter_enhanced_sample_age_seconds",
+	"Age of the last Enhanced Monitoring sample of the instance.",
+	[]string{"region", "instance"},
+	nil,
+)
+
 // Collector collects enhanced RDS metrics by utilizing several scrapers.
 type Collector struct {
 	sessions *sessions.Sessions
+	opts     Options
+	health   *health.Tracker
 	logger   log.Logger
 
-	rw      sync.RWMutex
-	metrics map[string][]prometheus.Metric
+	rw       sync.RWMutex
+	samples  map[string]*sample       // ResourceID -> latest sample
+	counters map[string]*counters     // ResourceID -> synthesized counters
+	buffers  map[string]*sampleBuffer // ResourceID -> latest samples
+
+	scrapersM sync.Mutex
+	scrapers  map[*session.Session]*runningScraper
+}
+
+// runningScraper represents scrapers started for a single session.
+type runningScraper struct {
+	instances []sessions.Instance
+	scrapers  map[time.Duration]*scraper // poll interval -> scraper
+	cancel    context.CancelFunc
+}
+
+// setInstances updates instances of running scrapers without restarting them.
+// Given instances must not differ from the current ones in fields checked by pollingChanged.
+func (r *runningScraper) setInstances(instances []sessions.Instance) {
+	for interval, group := range groupByInterval(instances) {
+		r.scrapers[interval].setInstances(group)
+	}
+	r.instances = instances
+}
+
+// pollingChanged returns true if given instances differ in fields that affect polling:
+// resource IDs (log stream names), poll intervals, or disabled Enhanced Monitoring metrics.
+func pollingChanged(a, b []sessions.Instance) bool {
+	if len(a) != len(b) {
+		return true
+	}
+	for i := range a {
+		if a[i].ResourceID != b[i].ResourceID ||
+			pollInterval(a[i]) != pollInterval(b[i]) ||
+			a[i].DisableEnhancedMetrics != b[i].DisableEnhancedMetrics {
+			return true
+		}
+	}
+	return false
 }
 
 // Maximal and minimal metrics update interval.
@@ -27,52 +118,218 @@ const (
 )
 
 // NewCollector creates new collector and starts scrapers.
-func NewCollector(sessions *sessions.Sessions) *Collector {
+// Scrapers are restarted when sessions or their instances are changed.
+func NewCollector(sessions *sessions.Sessions, opts Options) *Collector {
+	if opts.StaleIntervals <= 0 {
+		opts.StaleIntervals = DefaultStaleIntervals
+	}
+	if opts.Ingestion == "" {
+		opts.Ingestion = IngestionPoll
+	}
+	if opts.FirehoseBufferInterval <= 0 {
+		opts.FirehoseBufferInterval = DefaultFirehoseBufferInterval
+	}
+	if opts.BufferSize > 0 {
+		// buffered samples of the same series can be distinguished only by timestamps
+		opts.Timestamps = true
+	}
+
 	c := &Collector{
 		sessions: sessions,
+		opts:     opts,
+		health:   health.NewTracker("enhanced"),
 		logger:   log.With("component", "enhanced"),
-		metrics:  make(map[string][]prometheus.Metric),
+		samples:  make(map[string]*sample),
+		counters: make(map[string]*counters),
+		buffers:  make(map[string]*sampleBuffer),
+		scrapers: make(map[*session.Session]*runningScraper),
 	}
 
-	for session, instances := range sessions.AllSessions() {
-		s := newScraper(session, instances)
+	// subscribe first so updates during the first (synchronous) refresh are not lost
+	sessions.OnUpdate(c.refresh)
+	c.refresh()
+
+	return c
+}
+
+// refresh stops scrapers for removed sessions or sessions with changed polling, starts scrapers for new ones,
+// updates instances (labels, tags, metadata) of other running scrapers,
+// and removes metrics of instances that are no longer present.
+func (c *Collector) refresh() {
+	c.scrapersM.Lock()
+	defer c.scrapersM.Unlock()
+
+	// get sessions under lock so the last refresh always uses the latest ones
+	all := c.sessions.AllSessions()
+
+	for session, r := range c.scrapers {
+		instances, ok := all[session]
+		switch {
+		case !ok || pollingChanged(instances, r.instances):
+			r.cancel()
+			delete(c.scrapers, session)
+		case !reflect.DeepEqual(instances, r.instances):
+			r.setInstances(instances)
+		}
+	}
 
-		interval := maxInterval
+	resourceIDs := make(map[string]struct{})
+	var enabled []sessions.Instance
+	for session, instances := range all {
 		for _, instance := range instances {
-			if instance.EnhancedMonitoringInterval > 0 && instance.EnhancedMonitoringInterval < interval {
-				interval = instance.EnhancedMonitoringInterval
+			resourceIDs[instance.ResourceID] = struct{}{}
+			if !instance.DisableEnhancedMetrics {
+				enabled = append(enabled, instance)
 			}
 		}
-		if interval < minInterval {
-			interval = minInterval
+
+		if _, ok := c.scrapers[session]; ok || c.opts.Ingestion != IngestionPoll {
+			continue
+		}
+		c.scrapers[session] = c.start(session, instances)
+	}
+
+	c.rw.Lock()
+	for id := range c.samples {
+		if _, ok := resourceIDs[id]; !ok {
+			delete(c.samples, id)
+		}
+	}
+	for id := range c.counters {
+		if _, ok := resourceIDs[id]; !ok {
+			delete(c.counters, id)
+		}
+	}
+	for id := range c.buffers {
+		if _, ok := resourceIDs[id]; !ok {
+			delete(c.buffers, id)
 		}
-		s.logger.Infof("Updating enhanced metrics every %s.", interval)
+	}
+	c.rw.Unlock()
 
-		// perform first scrapes synchronously so returned collector has all metric descriptions
-		m, _ := s.scrape(context.TODO())
-		c.setMetrics(m)
+	c.health.Retain(enabled)
+}
 
-		ch := make(chan map[string][]prometheus.Metric)
-		go func() {
-			for m := range ch {
-				c.setMetrics(m)
-			}
-		}()
-		go s.start(context.TODO(), interval, ch)
+// start creates and starts new scrapers for given session and instances.
+// Instances are grouped by their Enhanced Monitoring intervals so each group is polled at its own rate.
+func (c *Collector) start(session *session.Session, instances []sessions.Instance) *runningScraper {
+	ctx, cancel := context.WithCancel(context.Background())
+	scrapers := make(map[time.Duration]*scraper)
+	for interval, group := range groupByInterval(instances) {
+		scrapers[interval] = c.startScraper(ctx, session, group, interval)
 	}
 
-	return c
+	return &runningScraper{
+		instances: instances,
+		scrapers:  scrapers,
+		cancel:    cancel,
+	}
 }
 
-// setMetrics saves latest scraped metrics.
-func (c *Collector) setMetrics(m map[string][]prometheus.Metric) {
+// pollInterval returns instance's Enhanced Monitoring interval clamped to [minInterval, maxInterval] range.
+func pollInterval(instance sessions.Instance) time.Duration {
+	interval := instance.EnhancedMonitoringInterval
+	if interval <= 0 || interval > maxInterval {
+		interval = maxInterval
+	}
+	if interval < minInterval {
+		interval = minInterval
+	}
+	return interval
+}
+
+// groupByInterval groups instances by their poll intervals.
+func groupByInterval(instances []sessions.Instance) map[time.Duration][]sessions.Instance {
+	res := make(map[time.Duration][]sessions.Instance)
+	for _, instance := range instances {
+		interval := pollInterval(instance)
+		res[interval] = append(res[interval], instance)
+	}
+	return res
+}
+
+// startScraper creates and starts a new scraper for given instances until context is canceled.
+// The first scrape is performed in the background, so it does not block sessions updates.
+func (c *Collector) startScraper(ctx context.Context, session *session.Session, instances []sessions.Instance, interval time.Duration) *scraper {
+	s := newScraper(session, instances, c.health)
+	s.processList = c.opts.ProcessList
+	s.logger.Infof("Updating enhanced metrics of %d instance(s) every %s.", len(instances), interval)
+
+	ch := make(chan map[string]*sample)
+	go func() {
+		for m := range ch {
+			// do not resurrect metrics of removed instances
+			if ctx.Err() != nil {
+				continue
+			}
+			c.setSamples(m)
+		}
+	}()
+	go s.start(ctx, interval, ch)
+	return s
+}
+
+// setSamples saves latest scraped samples, integrates rates of them and all earlier samples into counters,
+// and buffers them if enabled.
+// Samples older than already saved ones are ignored.
+func (c *Collector) setSamples(m map[string]*sample) {
 	c.rw.Lock()
-	for id, metrics := range m {
-		c.metrics[id] = metrics
+	for id, latest := range m {
+		samples := append(latest.earlier, latest)
+		latest.earlier = nil
+
+		for _, sample := range samples {
+			old := c.samples[id]
+			if old != nil && sample.timestamp.Before(old.timestamp) {
+				continue
+			}
+
+			cs := c.counters[id]
+			if cs == nil {
+				cs = &counters{values: make(map[string]float64)}
+				c.counters[id] = cs
+			}
+			// gaps between received events are allowed to span several polls or Firehose deliveries
+			sample.counters = cs.integrate(sample.timestamp, sample.rates, c.staleness(sample.instance))
+			c.samples[id] = sample
+
+			// do not buffer the same event twice
+			if c.opts.BufferSize > 0 && (old == nil || sample.timestamp.After(old.timestamp)) {
+				b := c.buffers[id]
+				if b == nil {
+					b = newSampleBuffer(c.opts.BufferSize)
+					c.buffers[id] = b
+				}
+				b.push(sample)
+			}
+		}
 	}
 	c.rw.Unlock()
 }
 
+// deliveryInterval returns the expected interval between receptions of given instance's events:
+// poll interval, or Firehose buffering interval.
+func (c *Collector) deliveryInterval(instance sessions.Instance) time.Duration {
+	if c.opts.Ingestion == IngestionFirehose {
+		return c.opts.FirehoseBufferInterval
+	}
+	return pollInterval(instance)
+}
+
+// staleness returns the age after which sample of given instance is considered stale.
+// Events are received with a delay and in batches, so the age is allowed to exceed
+// several Enhanced Monitoring intervals of fast instances.
+func (c *Collector) staleness(instance sessions.Instance) time.Duration {
+	interval := instance.EnhancedMonitoringInterval
+	if interval <= 0 {
+		interval = maxInterval
+	}
+	if d := c.deliveryInterval(instance); d > interval {
+		interval = d
+	}
+	return time.Duration(c.opts.StaleIntervals)*interval + deliveryLatency
+}
+
 // Describe implements prometheus.Collector.
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	// unchecked collector
@@ -80,17 +337,198 @@ func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 
 // Collect implements prometheus.Collector.
 func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+
 	c.rw.RLock()
-	defer c.rw.RUnlock()
+	for _, sample := range c.samples {
+		c.collectSample(sample, now, ch)
+	}
+	c.rw.RUnlock()
+
+	c.health.Collect(ch)
+}
+
+// collectSample sends sample age and, if sample is not stale, its metrics.
+// It returns false for stale sample.
+func (c *Collector) collectSample(sample *sample, now time.Time, ch chan<- prometheus.Metric) bool {
+	age, fresh := c.sampleAge(sample, now)
+	ch <- age
+	if !fresh {
+		return false
+	}
+	for _, m := range c.sampleMetrics(sample) {
+		ch <- m
+	}
+	return true
+}
 
-	for _, metrics := range c.metrics {
+// sampleAge returns sample age metric, and false for stale sample.
+func (c *Collector) sampleAge(sample *sample, now time.Time) (prometheus.Metric, bool) {
+	age := now.Sub(sample.timestamp)
+	m := prometheus.MustNewConstMetric(sampleAgeDesc, prometheus.GaugeValue, age.Seconds(),
+		sample.instance.Region, sample.instance.Instance)
+
+	// instance stopped reporting: do not expose its last values forever
+	return m, age <= c.staleness(sample.instance)
+}
+
+// sampleMetrics returns metrics and counters of given sample.
+func (c *Collector) sampleMetrics(sample *sample) []prometheus.Metric {
+	res := make([]prometheus.Metric, 0, len(sample.metrics)+len(sample.counters))
+	for _, metrics := range [][]prometheus.Metric{sample.metrics, sample.counters} {
 		for _, m := range metrics {
-			ch <- m
+			if c.opts.Timestamps {
+				m = prometheus.NewMetricWithTimestamp(sample.timestamp, m)
+			}
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+// metricsCollector is a collector of fixed metrics.
+type metricsCollector []prometheus.Metric
+
+// Describe implements prometheus.Collector.
+func (mc metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	// unchecked collector
+}
+
+// Collect implements prometheus.Collector.
+func (mc metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range mc {
+		ch <- m
+	}
+}
+
+// Gather implements prometheus.Gatherer.
+//
+// Unlike Collect, it exposes all buffered samples (see Options.BufferSize),
+// or the latest sample if buffering is disabled. Buffered samples are not removed,
+// so samples already ingested by the scraper are exposed again until they are overwritten by newer ones.
+// Registry rejects several metrics of the same series, so the n-th buffered samples of all instances
+// are gathered separately, and results are merged.
+func (c *Collector) Gather() ([]*dto.MetricFamily, error) {
+	now := time.Now()
+
+	layers := []metricsCollector{nil}
+	c.rw.Lock()
+	for id, latest := range c.samples {
+		samples := []*sample{latest}
+		if b := c.buffers[id]; b != nil {
+			if buffered := b.all(); len(buffered) != 0 {
+				samples = buffered
+			}
+		}
+
+		age, fresh := c.sampleAge(latest, now)
+		layers[0] = append(layers[0], age)
+		if !fresh {
+			continue
+		}
+		for i, s := range samples {
+			if i == len(layers) {
+				layers = append(layers, nil)
+			}
+			layers[i] = append(layers[i], c.sampleMetrics(s)...)
+		}
+	}
+	c.rw.Unlock()
+
+	families := make(map[string]*dto.MetricFamily)
+	for i, layer := range layers {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(layer)
+		if i == 0 {
+			registry.MustRegister(c.health)
+		}
+		mfs, err := registry.Gather()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, mf := range mfs {
+			if f := families[mf.GetName()]; f != nil {
+				f.Metric = append(f.Metric, mf.Metric...)
+				continue
+			}
+			families[mf.GetName()] = mf
 		}
 	}
+
+	// keep samples of the same series together, oldest first
+	res := make([]*dto.MetricFamily, 0, len(families))
+	for _, mf := range families {
+		sort.SliceStable(mf.Metric, func(i, j int) bool { return labelsKey(mf.Metric[i]) < labelsKey(mf.Metric[j]) })
+		res = append(res, mf)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].GetName() < res[j].GetName() })
+	return res, nil
+}
+
+// labelsKey returns a string identifying metric's series within a family.
+func labelsKey(m *dto.Metric) string {
+	var b strings.Builder
+	for _, l := range m.GetLabel() {
+		b.WriteString(l.GetName())
+		b.WriteByte(0)
+		b.WriteString(l.GetValue())
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+var probeErrorDesc = prometheus.NewDesc(
+	"rds_exporter_probe_error",
+	"Enhanced metrics probe error.",
+	nil,
+	nil,
+)
+
+// instanceCollector exposes enhanced metrics of a single instance.
+type instanceCollector struct {
+	c          *Collector
+	resourceID string
+}
+
+// InstanceCollector returns a collector that exposes the latest enhanced metrics of a single instance,
+// or nil if given instance is not monitored or has disabled enhanced metrics.
+// Collection fails if there is no recent sample for the instance.
+func (c *Collector) InstanceCollector(region, instance string) prometheus.Collector {
+	_, i := c.sessions.GetSession(region, instance)
+	if i == nil || i.DisableEnhancedMetrics {
+		return nil
+	}
+
+	return &instanceCollector{
+		c:          c,
+		resourceID: i.ResourceID,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (ic *instanceCollector) Describe(ch chan<- *prometheus.Desc) {
+	// unchecked collector
+}
+
+// Collect implements prometheus.Collector.
+func (ic *instanceCollector) Collect(ch chan<- prometheus.Metric) {
+	ic.c.rw.RLock()
+	defer ic.c.rw.RUnlock()
+
+	sample := ic.c.samples[ic.resourceID]
+	if sample == nil {
+		ch <- prometheus.NewInvalidMetric(probeErrorDesc, fmt.Errorf("no enhanced metrics for %s", ic.resourceID))
+		return
+	}
+	if !ic.c.collectSample(sample, time.Now(), ch) {
+		ch <- prometheus.NewInvalidMetric(probeErrorDesc, fmt.Errorf("enhanced metrics for %s are stale", ic.resourceID))
+	}
 }
 
 // check interfaces
 var (
 	_ prometheus.Collector = (*Collector)(nil)
+	_ prometheus.Gatherer  = (*Collector)(nil)
+	_ prometheus.Collector = (*instanceCollector)(nil)
 )
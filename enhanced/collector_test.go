@@ -0,0 +1,421 @@
+package enhanced
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/percona/exporter_shared/helpers"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/percona/rds_exporter/client"
+	"github.com/percona/rds_exporter/config"
+	"github.com/percona/rds_exporter/fakeaws"
+	"github.com/percona/rds_exporter/health"
+	"github.com/percona/rds_exporter/sessions"
+)
+
+// waitSample waits for the first sample of given instance; the first scrape is performed in the background.
+func waitSample(t *testing.T, c *Collector, resourceID string) {
+	t.Helper()
+
+	for i := 0; i < 100; i++ {
+		c.rw.RLock()
+		s := c.samples[resourceID]
+		c.rw.RUnlock()
+		if s != nil {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("no sample for %s", resourceID)
+}
+
+func TestCollectorStale(t *testing.T) {
+	makeSample := func(instance string, age time.Duration) *sample {
+		return &sample{
+			instance: sessions.Instance{
+				Region:                     "us-east-1",
+				Instance:                   instance,
+				EnhancedMonitoringInterval: 10 * time.Second,
+			},
+			timestamp: time.Now().Add(-age),
+			metrics: []prometheus.Metric{prometheus.MustNewConstMetric(
+				prometheus.NewDesc("test_metric", "Test metric.", nil, prometheus.Labels{"instance": instance}),
+				prometheus.GaugeValue,
+				1,
+			)},
+		}
+	}
+
+	c := &Collector{
+		opts:   Options{StaleIntervals: DefaultStaleIntervals},
+		health: health.NewTracker("enhanced"),
+		samples: map[string]*sample{
+			"db-FRESH": makeSample("fresh", 5*time.Second),
+			"db-STALE": makeSample("stale", time.Minute),
+		},
+		counters: make(map[string]*counters),
+	}
+
+	// newer samples replace older ones, but not vice versa
+	c.setSamples(map[string]*sample{"db-FRESH": makeSample("fresh", 10*time.Second)})
+	assert.InDelta(t, 5, time.Since(c.samples["db-FRESH"].timestamp).Seconds(), 1)
+	c.setSamples(map[string]*sample{"db-STALE": makeSample("stale", time.Second)})
+	assert.InDelta(t, 1, time.Since(c.samples["db-STALE"].timestamp).Seconds(), 1)
+	c.samples["db-STALE"] = makeSample("stale", 2*time.Minute)
+
+	metrics := helpers.ReadMetrics(helpers.CollectMetrics(c))
+	var names []string
+	ages := make(map[string]float64)
+	for _, m := range metrics {
+		switch m.Name {
+		case "test_metric":
+			names = append(names, m.Labels["instance"])
+		case "rds_exporter_enhanced_sample_age_seconds":
+			ages[m.Labels["instance"]] = m.Value
+		}
+	}
+	assert.Equal(t, []string{"fresh"}, names)
+	assert.InDelta(t, 5, ages["fresh"], 1)
+	assert.InDelta(t, 120, ages["stale"], 1)
+}
+
+func TestCollectorStaleness(t *testing.T) {
+	for _, tc := range []struct {
+		ingestion IngestionMode
+		interval  time.Duration
+		age       time.Duration
+		fresh     bool
+	}{
+		// events of fast instances are polled less often and delivered with a delay
+		{IngestionPoll, time.Second, 10 * time.Second, true},
+		{IngestionPoll, time.Second, time.Minute, false},
+		{IngestionPoll, time.Minute, 3 * time.Minute, true},
+		{IngestionPoll, time.Minute, 5 * time.Minute, false},
+
+		// events are delivered in batches every buffering interval
+		{IngestionFirehose, time.Second, 2 * time.Minute, true},
+		{IngestionFirehose, time.Second, 5 * time.Minute, false},
+	} {
+		c := &Collector{
+			opts: Options{
+				StaleIntervals:         DefaultStaleIntervals,
+				Ingestion:              tc.ingestion,
+				FirehoseBufferInterval: DefaultFirehoseBufferInterval,
+			},
+		}
+		s := &sample{
+			instance:  sessions.Instance{EnhancedMonitoringInterval: tc.interval},
+			timestamp: time.Now().Add(-tc.age),
+		}
+		_, fresh := c.sampleAge(s, time.Now())
+		assert.Equal(t, tc.fresh, fresh, "%s %s %s", tc.ingestion, tc.interval, tc.age)
+	}
+}
+
+func TestCollectorTimestamps(t *testing.T) {
+	timestamp := time.Now().Add(-5 * time.Second).Truncate(time.Millisecond)
+	s := &sample{
+		instance: sessions.Instance{
+			Region:                     "us-east-1",
+			Instance:                   "test",
+			EnhancedMonitoringInterval: 10 * time.Second,
+		},
+		timestamp: timestamp,
+		metrics: []prometheus.Metric{prometheus.MustNewConstMetric(
+			prometheus.NewDesc("test_metric", "Test metric.", nil, nil),
+			prometheus.GaugeValue,
+			1,
+		)},
+	}
+
+	for _, timestamps := range []bool{false, true} {
+		c := &Collector{
+			opts:     Options{StaleIntervals: DefaultStaleIntervals, Timestamps: timestamps},
+			health:   health.NewTracker("enhanced"),
+			samples:  map[string]*sample{"db-TEST": s},
+			counters: make(map[string]*counters),
+		}
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(c)
+		mfs, err := registry.Gather()
+		require.NoError(t, err)
+
+		actual := make(map[string]int64)
+		for _, mf := range mfs {
+			actual[mf.GetName()] = mf.GetMetric()[0].GetTimestampMs()
+		}
+		expected := map[string]int64{"rds_exporter_enhanced_sample_age_seconds": 0, "test_metric": 0}
+		if timestamps {
+			expected["test_metric"] = timestamp.UnixNano() / int64(time.Millisecond)
+		}
+		assert.Equal(t, expected, actual, "timestamps=%t", timestamps)
+	}
+}
+
+func TestInstanceCollector(t *testing.T) {
+	cfg := fakeaws.New(t).LoadConfig(t, "../config.tests.yml")
+	client := client.New()
+	sess, err := sessions.New(cfg.Instances, client.HTTP(), false)
+	require.NoError(t, err)
+
+	c := NewCollector(sess, Options{})
+	assert.Nil(t, c.InstanceCollector("us-west-2", "no-such-instance"))
+	waitSample(t, c, "db-QXZYJIL5GR3CBQ4XNCYU2AI5PE")
+
+	ic := c.InstanceCollector("us-west-2", "autotest-mysql-57")
+	require.NotNil(t, ic)
+	instances := make(map[string]struct{})
+	for _, m := range helpers.ReadMetrics(helpers.CollectMetrics(ic)) {
+		instances[m.Labels["instance"]] = struct{}{}
+	}
+	assert.Equal(t, map[string]struct{}{"autotest-mysql-57": {}}, instances)
+
+	// stale sample makes collection fail
+	_, instance := sess.GetSession("us-west-2", "autotest-mysql-57")
+	c.rw.Lock()
+	c.samples[instance.ResourceID].timestamp = time.Now().Add(-time.Hour)
+	c.rw.Unlock()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(ic)
+	_, err = registry.Gather()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "enhanced metrics for db-QXZYJIL5GR3CBQ4XNCYU2AI5PE are stale")
+}
+
+func TestCollectorGather(t *testing.T) {
+	now := time.Now().Truncate(time.Millisecond)
+	makeSample := func(instance string, value int) *sample {
+		return &sample{
+			instance: sessions.Instance{
+				Region:                     "us-east-1",
+				Instance:                   instance,
+				EnhancedMonitoringInterval: time.Second,
+			},
+			timestamp: now.Add(time.Duration(value-10) * time.Second),
+			metrics: []prometheus.Metric{prometheus.MustNewConstMetric(
+				prometheus.NewDesc("test_metric", "Test metric.", nil, prometheus.Labels{"instance": instance}),
+				prometheus.GaugeValue,
+				float64(value),
+			)},
+		}
+	}
+
+	c := &Collector{
+		opts:     Options{StaleIntervals: 100, Timestamps: true, BufferSize: 3},
+		health:   health.NewTracker("enhanced"),
+		samples:  make(map[string]*sample),
+		counters: make(map[string]*counters),
+		buffers:  make(map[string]*sampleBuffer),
+	}
+
+	type point struct {
+		instance  string
+		value     float64
+		timestamp int64
+	}
+	gather := func() []point {
+		mfs, err := c.Gather()
+		require.NoError(t, err)
+		var res []point
+		for _, mf := range mfs {
+			if mf.GetName() != "test_metric" {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				res = append(res, point{m.GetLabel()[0].GetValue(), m.GetGauge().GetValue(), m.GetTimestampMs()})
+			}
+		}
+		return res
+	}
+	ms := func(value int) int64 {
+		return now.Add(time.Duration(value-10)*time.Second).UnixNano() / int64(time.Millisecond)
+	}
+
+	// the oldest sample does not fit into the buffer
+	a := makeSample("a", 4)
+	a.earlier = []*sample{makeSample("a", 1), makeSample("a", 2), makeSample("a", 3)}
+	c.setSamples(map[string]*sample{"db-A": a, "db-B": makeSample("b", 2)})
+	expected := []point{{"a", 2, ms(2)}, {"a", 3, ms(3)}, {"a", 4, ms(4)}, {"b", 2, ms(2)}}
+	assert.Equal(t, expected, gather())
+
+	// samples are kept for other scrapers
+	assert.Equal(t, expected, gather())
+
+	// already seen samples are not buffered again
+	a = makeSample("a", 5)
+	a.earlier = []*sample{makeSample("a", 3), makeSample("a", 4)}
+	c.setSamples(map[string]*sample{"db-A": a})
+	expected = []point{{"a", 3, ms(3)}, {"a", 4, ms(4)}, {"a", 5, ms(5)}, {"b", 2, ms(2)}}
+	assert.Equal(t, expected, gather())
+}
+
+func TestCollectorDelayedEvents(t *testing.T) {
+	fake := fakeaws.New(t)
+	cfg := fake.LoadConfig(t, "../config.tests.yml")
+	fake.SetInstance(fakeaws.Instance{
+		Region:             "us-west-2",
+		Instance:           "autotest-mysql-57",
+		ResourceID:         "db-QXZYJIL5GR3CBQ4XNCYU2AI5PE",
+		Engine:             "mysql",
+		MonitoringInterval: 1,
+	})
+	fake.SetLogDelay(10 * time.Second)
+	sess, err := sessions.New(cfg.Instances[2:3], client.New().HTTP(), false)
+	require.NoError(t, err)
+
+	c := NewCollector(sess, Options{})
+	ic := c.InstanceCollector("us-west-2", "autotest-mysql-57")
+	require.NotNil(t, ic)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(ic)
+	var mfs []*dto.MetricFamily
+	for i := 0; i < 100; i++ {
+		if mfs, err = registry.Gather(); err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	require.NoError(t, err)
+	assert.NotEmpty(t, mfs)
+}
+
+func TestCollectorCounters(t *testing.T) {
+	// several events are returned by a single poll; all of them are integrated without buffering
+	fake := fakeaws.New(t)
+	cfg := fake.LoadConfig(t, "../config.tests.yml")
+	fake.SetLogEvents(3)
+	sess, err := sessions.New(cfg.Instances[2:3], client.New().HTTP(), false)
+	require.NoError(t, err)
+
+	m, err := parseOSMetrics(readTestDataJSON(t, "mysql-57"), true)
+	require.NoError(t, err)
+
+	c := NewCollector(sess, Options{})
+	ic := c.InstanceCollector("us-west-2", "autotest-mysql-57")
+	require.NotNil(t, ic)
+	waitSample(t, c, "db-QXZYJIL5GR3CBQ4XNCYU2AI5PE")
+	var value float64
+	for _, metric := range helpers.ReadMetrics(helpers.CollectMetrics(ic)) {
+		if metric.Name == "node_network_receive_bytes_total" && metric.Labels["device"] == "eth0" {
+			value = metric.Value
+		}
+	}
+	assert.InDelta(t, 120*m.Network[0].Rx, value, 0.001)
+}
+
+func TestGroupByInterval(t *testing.T) {
+	instances := []sessions.Instance{
+		{Instance: "1s", EnhancedMonitoringInterval: time.Second},
+		{Instance: "5s", EnhancedMonitoringInterval: 5 * time.Second},
+		{Instance: "60s", EnhancedMonitoringInterval: time.Minute},
+		{Instance: "disabled"},
+		{Instance: "5s-2", EnhancedMonitoringInterval: 5 * time.Second},
+	}
+	actual := make(map[time.Duration][]string)
+	for interval, group := range groupByInterval(instances) {
+		for _, instance := range group {
+			actual[interval] = append(actual[interval], instance.Instance)
+		}
+	}
+	expected := map[time.Duration][]string{
+		minInterval:     {"1s"},
+		5 * time.Second: {"5s", "5s-2"},
+		maxInterval:     {"60s", "disabled"},
+	}
+	assert.Equal(t, expected, actual)
+}
+
+func TestCollectorDiscoveryDuringStart(t *testing.T) {
+	fake := fakeaws.New(t)
+	cfg := fake.LoadConfig(t, "../config.tests.yml")
+	sess, err := sessions.New(cfg.Instances[:1], client.New().HTTP(), false)
+	require.NoError(t, err)
+	discovered := cfg.Instances[2]
+	require.Equal(t, "autotest-mysql-57", discovered.Instance)
+
+	// discover an instance while the first scrape is running
+	var once sync.Once
+	done := make(chan error, 1)
+	fake.OnRequest("FilterLogEvents", func() {
+		once.Do(func() {
+			go func() { done <- sess.SetDiscovered([]config.Instance{discovered}) }()
+
+			// subscribers are notified after sessions are updated
+			for i := 0; i < 100; i++ {
+				if s, _ := sess.GetSession(discovered.Region, discovered.Instance); s != nil {
+					return
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+			t.Error("discovered instance was not added")
+		})
+	})
+
+	c := NewCollector(sess, Options{})
+	require.NoError(t, <-done)
+	fake.OnRequest("FilterLogEvents", nil)
+	waitSample(t, c, "db-QXZYJIL5GR3CBQ4XNCYU2AI5PE")
+}
+
+func TestCollectorRefresh(t *testing.T) {
+	fake := fakeaws.New(t)
+	cfg := fake.LoadConfig(t, "../config.tests.yml")
+	sess, err := sessions.New(cfg.Instances[2:3], client.New().HTTP(), false)
+	require.NoError(t, err)
+
+	// the first scrape does not block collector creation and sessions updates
+	release := make(chan struct{})
+	fake.OnRequest("FilterLogEvents", func() {
+		select {
+		case <-release:
+		case <-time.After(5 * time.Second):
+		}
+	})
+	start := time.Now()
+	c := NewCollector(sess, Options{})
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	close(release)
+	fake.OnRequest("FilterLogEvents", nil)
+	waitSample(t, c, "db-QXZYJIL5GR3CBQ4XNCYU2AI5PE")
+
+	running := func() *runningScraper {
+		c.scrapersM.Lock()
+		defer c.scrapersM.Unlock()
+		require.Len(t, c.scrapers, 1)
+		for _, r := range c.scrapers {
+			return r
+		}
+		return nil
+	}
+	first := running()
+	requests := fake.Requests("FilterLogEvents")
+
+	// metadata changes do not restart polling, but are passed to the running scraper
+	instance := fakeaws.Instance{
+		Region:             "us-west-2",
+		Instance:           "autotest-mysql-57",
+		ResourceID:         "db-QXZYJIL5GR3CBQ4XNCYU2AI5PE",
+		Engine:             "mysql",
+		MonitoringInterval: 60,
+		InstanceClass:      "db.r5.large",
+	}
+	fake.SetInstance(instance)
+	require.NoError(t, sess.Refresh())
+	assert.Same(t, first, running())
+	assert.Equal(t, requests, fake.Requests("FilterLogEvents"))
+	s := first.scrapers[time.Minute]
+	s.instancesM.RLock()
+	assert.Equal(t, "db.r5.large", s.instances[0].Info.InstanceClass)
+	s.instancesM.RUnlock()
+
+	// poll interval changes restart polling
+	instance.MonitoringInterval = 5
+	fake.SetInstance(instance)
+	require.NoError(t, sess.Refresh())
+	assert.NotSame(t, first, running())
+}
@@ -0,0 +1,96 @@
+package enhanced
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// counterRate is a per-second rate of a node_exporter-like counter synthesized from Enhanced Monitoring metrics.
+type counterRate struct {
+	desc        *prometheus.Desc
+	labelValues []string
+	rate        float64
+}
+
+// key returns a string identifying counter's time series.
+func (r *counterRate) key() string {
+	return r.desc.String() + "\x00" + strings.Join(r.labelValues, "\x00")
+}
+
+// makeCounterRates returns per-second rates of node_exporter-like counters.
+//
+//nolint:lll
+func (m *osMetrics) makeCounterRates(region string, labels map[string]string) []counterRate {
+	constLabels := makeConstLabels(region, m.InstanceID, labels)
+	if m.windows != nil {
+		return m.windows.makeCounterRates(constLabels)
+	}
+
+	res := make([]counterRate, 0, 16)
+
+	// Enhanced Monitoring reports only average CPU utilization, so each virtual CPU gets the same share
+	// like node_exporter's per-CPU series; guest time is already included in user time
+	cpuDesc := newDesc("node_cpu_seconds_total", "Seconds the CPUs spent in each mode.", []string{"cpu", "mode"}, constLabels)
+	cpu := m.CPUUtilization
+	for mode, value := range map[string]float64{
+		"idle":    cpu.Idle,
+		"softirq": cpu.Irq,
+		"nice":    cpu.Nice,
+		"steal":   cpu.Steal,
+		"system":  cpu.System,
+		"user":    cpu.User,
+		"iowait":  cpu.Wait,
+	} {
+		for i := 0; i < m.NumVCPUs; i++ {
+			res = append(res, counterRate{cpuDesc, []string{strconv.Itoa(i), mode}, value / 100})
+		}
+	}
+
+	readsDesc := newDesc("node_disk_reads_completed_total", "The total number of reads completed successfully.", []string{"device"}, constLabels)
+	writesDesc := newDesc("node_disk_writes_completed_total", "The total number of writes completed successfully.", []string{"device"}, constLabels)
+	for _, disks := range [][]diskIO{m.DiskIO, m.PhysicalDeviceIO} {
+		for _, disk := range disks {
+			res = append(res, counterRate{readsDesc, []string{disk.Device}, disk.ReadIOsPS})
+			res = append(res, counterRate{writesDesc, []string{disk.Device}, disk.WriteIOsPS})
+		}
+	}
+
+	rxDesc := newDesc("node_network_receive_bytes_total", "Network device statistic receive_bytes.", []string{"device"}, constLabels)
+	txDesc := newDesc("node_network_transmit_bytes_total", "Network device statistic transmit_bytes.", []string{"device"}, constLabels)
+	for _, n := range m.Network {
+		res = append(res, counterRate{rxDesc, []string{n.Interface}, n.Rx})
+		res = append(res, counterRate{txDesc, []string{n.Interface}, n.Tx})
+	}
+
+	return res
+}
+
+// counters contains synthesized counters of a single instance.
+type counters struct {
+	timestamp time.Time          // timestamp of the last integrated sample
+	values    map[string]float64 // counterRate key -> value
+}
+
+// integrate adds given rates integrated over the gap between the last integrated and given timestamps,
+// and returns counter metrics. Counters start from zero; rates with timestamp that is not newer are ignored.
+// Rates are not integrated over gaps longer than maxGap (missed events or outages) to avoid fabricated jumps.
+func (c *counters) integrate(timestamp time.Time, rates []counterRate, maxGap time.Duration) []prometheus.Metric {
+	if gap := timestamp.Sub(c.timestamp); !c.timestamp.IsZero() && gap > 0 && gap <= maxGap {
+		dt := gap.Seconds()
+		for _, r := range rates {
+			c.values[r.key()] += r.rate * dt
+		}
+	}
+	if timestamp.After(c.timestamp) {
+		c.timestamp = timestamp
+	}
+
+	res := make([]prometheus.Metric, 0, len(rates))
+	for _, r := range rates {
+		res = append(res, prometheus.MustNewConstMetric(r.desc, prometheus.CounterValue, c.values[r.key()], r.labelValues...))
+	}
+	return res
+}
@@ -0,0 +1,91 @@
+package enhanced
+
+import (
+	"testing"
+	"time"
+
+	"github.com/percona/exporter_shared/helpers"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounters(t *testing.T) {
+	m, err := parseOSMetrics(readTestDataJSON(t, "mysql-57"), true)
+	require.NoError(t, err)
+
+	values := func(metrics []prometheus.Metric) map[string]float64 {
+		res := make(map[string]float64)
+		for _, m := range helpers.ReadMetrics(metrics) {
+			key := m.Name
+			if cpu := m.Labels["cpu"]; cpu != "" {
+				key += "/" + cpu
+			}
+			if mode := m.Labels["mode"]; mode != "" {
+				key += "/" + mode
+			}
+			if device := m.Labels["device"]; device != "" {
+				key += "/" + device
+			}
+			res[key] = m.Value
+		}
+		return res
+	}
+
+	c := &counters{values: make(map[string]float64)}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	rates := m.makeCounterRates("us-west-2", nil)
+	maxGap := 3 * time.Minute
+
+	// counters start from zero
+	first := values(c.integrate(start, rates, maxGap))
+	assert.Equal(t, 0.0, first["node_network_receive_bytes_total/eth0"])
+	assert.Equal(t, 0.0, first["node_cpu_seconds_total/0/user"])
+	assert.NotContains(t, first, "node_cpu_seconds_total/0/guest")
+
+	// rates are integrated over the gap between event timestamps
+	second := values(c.integrate(start.Add(10*time.Second), rates, maxGap))
+	assert.InDelta(t, 10*m.Network[0].Rx, second["node_network_receive_bytes_total/eth0"], 0.001)
+	assert.InDelta(t, 10*m.Network[0].Tx, second["node_network_transmit_bytes_total/eth0"], 0.001)
+	assert.InDelta(t, 10*m.CPUUtilization.User/100, second["node_cpu_seconds_total/0/user"], 0.001)
+	assert.InDelta(t, 10*m.CPUUtilization.Wait/100, second["node_cpu_seconds_total/0/iowait"], 0.001)
+	assert.InDelta(t, 10*m.DiskIO[0].WriteIOsPS, second["node_disk_writes_completed_total/rdsdev"], 0.001)
+	assert.InDelta(t, 10*m.PhysicalDeviceIO[0].WriteIOsPS, second["node_disk_writes_completed_total/xvdg"], 0.001)
+	assert.InDelta(t, 10*m.DiskIO[1].ReadIOsPS, second["node_disk_reads_completed_total/filesystem"], 0.001)
+
+	// the same or older event does not change counters
+	assert.Equal(t, second, values(c.integrate(start.Add(10*time.Second), rates, maxGap)))
+	assert.Equal(t, second, values(c.integrate(start.Add(5*time.Second), rates, maxGap)))
+
+	// counters are monotonic with irregular gaps
+	third := values(c.integrate(start.Add(70*time.Second), rates, maxGap))
+	assert.InDelta(t, 70*m.Network[0].Rx, third["node_network_receive_bytes_total/eth0"], 0.001)
+
+	// rates are not integrated over long gaps
+	fourth := values(c.integrate(start.Add(70*time.Second+time.Hour), rates, maxGap))
+	assert.Equal(t, third, fourth)
+	fifth := values(c.integrate(start.Add(80*time.Second+time.Hour), rates, maxGap))
+	assert.InDelta(t, 80*m.Network[0].Rx, fifth["node_network_receive_bytes_total/eth0"], 0.001)
+}
+
+func TestWindowsCounters(t *testing.T) {
+	m, err := parseOSMetrics(readTestDataJSON(t, "sqlserver-2019"), true)
+	require.NoError(t, err)
+	require.NotNil(t, m.windows)
+
+	values := make(map[string]float64)
+	c := &counters{values: make(map[string]float64)}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	rates := m.makeCounterRates("eu-west-1", nil)
+	c.integrate(start, rates, time.Minute)
+	for _, m := range helpers.ReadMetrics(c.integrate(start.Add(10*time.Second), rates, time.Minute)) {
+		values[m.Name+"/"+m.Labels["mode"]+m.Labels["nic"]+m.Labels["volume"]] = m.Value
+	}
+
+	w := m.windows
+	assert.InDelta(t, 10*w.CPUUtilization.Kern/100*float64(w.NumVCPUs), values["windows_cpu_time_total/privileged"], 0.001)
+	assert.InDelta(t, 10*w.Network[0].RdBytesPS, values["windows_net_bytes_received_total/Amazon Elastic Network Adapter"], 0.001)
+	assert.InDelta(t, 10*w.Disks[0].WrBytesPS, values["windows_logical_disk_write_bytes_total/rdsdbdata"], 0.001)
+	assert.InDelta(t, 10*w.Disks[1].RdCountPS, values["windows_logical_disk_reads_total/C:"], 0.001)
+	assert.NotContains(t, values, "node_cpu_seconds_total/user")
+}
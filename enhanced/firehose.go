@@ -0,0 +1,232 @@
+package enhanced
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/prometheus/common/log"
+
+	"github.com/percona/rds_exporter/sessions"
+)
+
+// IngestionMode defines how Enhanced Monitoring events are received.
+type IngestionMode string
+
+// Ingestion modes.
+const (
+	IngestionPoll     IngestionMode = "poll"     // poll CloudWatch Logs with FilterLogEvents
+	IngestionFirehose IngestionMode = "firehose" // receive Kinesis Data Firehose HTTP endpoint deliveries
+)
+
+// IngestionModes contains all valid ingestion modes.
+var IngestionModes = []IngestionMode{IngestionPoll, IngestionFirehose}
+
+// maxFirehoseRequestSize is the maximal accepted size of Firehose request body.
+const maxFirehoseRequestSize = 64 << 20
+
+// firehoseRequest represents Kinesis Data Firehose HTTP endpoint delivery request.
+//
+// See https://docs.aws.amazon.com/firehose/latest/dev/httpdeliveryrequestresponse.html
+type firehoseRequest struct {
+	RequestID string `json:"requestId"`
+	Timestamp int64  `json:"timestamp"`
+	Records   []struct {
+		Data []byte `json:"data"` // base64-encoded in JSON
+	} `json:"records"`
+}
+
+// firehoseResponse represents Kinesis Data Firehose HTTP endpoint delivery response.
+type firehoseResponse struct {
+	RequestID    string `json:"requestId"`
+	Timestamp    int64  `json:"timestamp"`
+	ErrorMessage string `json:"errorMessage,omitempty"`
+}
+
+// subscriptionRecord represents CloudWatch Logs subscription filter record.
+//
+// See https://docs.aws.amazon.com/AmazonCloudWatch/latest/logs/SubscriptionFilters.html
+type subscriptionRecord struct {
+	MessageType string `json:"messageType"`
+	LogGroup    string `json:"logGroup"`
+	LogStream   string `json:"logStream"`
+	LogEvents   []struct {
+		ID        string `json:"id"`
+		Timestamp int64  `json:"timestamp"`
+		Message   string `json:"message"`
+	} `json:"logEvents"`
+}
+
+// firehoseHandler receives Enhanced Monitoring events from Kinesis Data Firehose deliveries
+// of CloudWatch Logs subscription records.
+type firehoseHandler struct {
+	c         *Collector
+	accessKey string
+	logger    log.Logger
+}
+
+// FirehoseHandler returns HTTP handler for Kinesis Data Firehose HTTP endpoint deliveries
+// of RDSOSMetrics log group subscription records. Requests must contain given access key.
+func (c *Collector) FirehoseHandler(accessKey string) http.Handler {
+	return &firehoseHandler{
+		c:         c,
+		accessKey: accessKey,
+		logger:    log.With("component", "firehose"),
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *firehoseHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	requestID := req.Header.Get("X-Amz-Firehose-Request-Id")
+
+	if req.Method != http.MethodPost {
+		h.respond(rw, requestID, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", req.Method))
+		return
+	}
+
+	key := req.Header.Get("X-Amz-Firehose-Access-Key")
+	if subtle.ConstantTimeCompare([]byte(key), []byte(h.accessKey)) != 1 {
+		h.respond(rw, requestID, http.StatusUnauthorized, fmt.Errorf("invalid access key"))
+		return
+	}
+
+	var body io.Reader = http.MaxBytesReader(rw, req.Body, maxFirehoseRequestSize)
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gr, err := gzip.NewReader(body)
+		if err != nil {
+			h.respond(rw, requestID, http.StatusBadRequest, err)
+			return
+		}
+		defer gr.Close() //nolint:errcheck
+		body = gr
+	}
+
+	var r firehoseRequest
+	if err := json.NewDecoder(body).Decode(&r); err != nil {
+		h.respond(rw, requestID, http.StatusBadRequest, fmt.Errorf("failed to decode request: %s", err))
+		return
+	}
+	if requestID == "" {
+		requestID = r.RequestID
+	}
+
+	samples, err := h.samples(&r)
+	if err != nil {
+		h.respond(rw, requestID, http.StatusBadRequest, err)
+		return
+	}
+	h.c.setSamples(samples)
+
+	h.respond(rw, requestID, http.StatusOK, nil)
+}
+
+// samples returns the latest sample for each instance (keyed by ResourceID) from given request,
+// with all earlier samples of the same delivery.
+func (h *firehoseHandler) samples(r *firehoseRequest) (map[string]*sample, error) {
+	instances := make(map[string]sessions.Instance)
+	for _, is := range h.c.sessions.AllSessions() {
+		for _, instance := range is {
+			instances[instance.ResourceID] = instance
+		}
+	}
+
+	allSamples := make(map[string][]*sample) // ResourceID -> samples
+	for i, record := range r.Records {
+		data, err := gunzip(record.Data)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %s", i, err)
+		}
+
+		var sr subscriptionRecord
+		if err = json.Unmarshal(data, &sr); err != nil {
+			return nil, fmt.Errorf("record %d: failed to decode subscription record: %s", i, err)
+		}
+
+		l := h.logger.With("LogGroup", sr.LogGroup).With("LogStreamName", sr.LogStream)
+		if sr.MessageType != "DATA_MESSAGE" {
+			l.Debugf("Skipping %s record.", sr.MessageType)
+			continue
+		}
+		if sr.LogGroup != "RDSOSMetrics" {
+			l.Warnf("Skipping record of unexpected log group.")
+			continue
+		}
+
+		instance, ok := instances[sr.LogStream]
+		if !ok {
+			l.Debugf("Skipping record of unknown instance.")
+			continue
+		}
+		if instance.DisableEnhancedMetrics {
+			l.Debugf("Enhanced Metrics are disabled for instance %v.", instance)
+			continue
+		}
+		l = l.With("region", instance.Region).With("instance", instance.Instance)
+
+		for _, event := range sr.LogEvents {
+			osMetrics, err := parseOSMetrics([]byte(event.Message), false)
+			if err != nil {
+				l.With("EventId", event.ID).Errorf("Failed to parse metrics: %s.", err)
+				continue
+			}
+
+			timestamp := time.Unix(0, event.Timestamp*int64(time.Millisecond)).UTC()
+			allSamples[instance.ResourceID] = append(allSamples[instance.ResourceID], osMetrics.makeSample(instance, timestamp, event.Message, h.c.opts.ProcessList))
+		}
+		h.c.health.Success(instance)
+	}
+
+	res := make(map[string]*sample, len(allSamples))
+	for resourceID, samples := range allSamples {
+		sort.SliceStable(samples, func(i, j int) bool { return samples[i].timestamp.Before(samples[j].timestamp) })
+		latest := samples[len(samples)-1]
+		latest.earlier = samples[:len(samples)-1]
+		res[resourceID] = latest
+	}
+	return res, nil
+}
+
+// respond writes Firehose response with given status code and error.
+func (h *firehoseHandler) respond(rw http.ResponseWriter, requestID string, code int, err error) {
+	resp := firehoseResponse{
+		RequestID: requestID,
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+	}
+	if err != nil {
+		h.logger.With("RequestId", requestID).Errorf("Failed to handle request: %s.", err)
+		h.c.health.Error("firehose", err)
+		resp.ErrorMessage = err.Error()
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	if err = json.NewEncoder(rw).Encode(resp); err != nil {
+		h.logger.Errorf("Failed to write response: %s.", err)
+	}
+}
+
+// gunzip decompresses gzip data; other data is returned as is.
+func gunzip(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		return data, nil
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close() //nolint:errcheck
+	return ioutil.ReadAll(gr)
+}
+
+// check interfaces
+var (
+	_ http.Handler = (*firehoseHandler)(nil)
+)
@@ -0,0 +1,174 @@
+package enhanced
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/percona/exporter_shared/helpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/percona/rds_exporter/client"
+	"github.com/percona/rds_exporter/fakeaws"
+	"github.com/percona/rds_exporter/sessions"
+)
+
+func TestFirehoseHandler(t *testing.T) {
+	cfg := fakeaws.New(t).LoadConfig(t, "../config.tests.yml")
+	client := client.New()
+	sess, err := sessions.New(cfg.Instances, client.HTTP(), false)
+	require.NoError(t, err)
+
+	c := NewCollector(sess, Options{Ingestion: IngestionFirehose, BufferSize: 10})
+	assert.Empty(t, c.scrapers)
+	assert.Empty(t, c.samples)
+
+	h := c.FirehoseHandler("secret")
+	payload := readTestDataJSON(t, "firehose-mysql-57")
+	post := func(key string, body []byte, gzipped bool) (int, firehoseResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/firehose", bytes.NewReader(body))
+		req.Header.Set("X-Amz-Firehose-Access-Key", key)
+		if gzipped {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		var resp firehoseResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return rec.Code, resp
+	}
+
+	t.Run("InvalidAccessKey", func(t *testing.T) {
+		code, resp := post("wrong", payload, false)
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.Equal(t, "invalid access key", resp.ErrorMessage)
+		assert.Empty(t, c.samples)
+	})
+
+	t.Run("InvalidBody", func(t *testing.T) {
+		code, resp := post("secret", []byte(`{"records": [{"data": "not base64"}]}`), false)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Contains(t, resp.ErrorMessage, "failed to decode request")
+	})
+
+	t.Run("Recorded", func(t *testing.T) {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		_, err := gw.Write(payload)
+		require.NoError(t, err)
+		require.NoError(t, gw.Close())
+
+		for _, gzipped := range []bool{false, true} {
+			body := payload
+			if gzipped {
+				body = buf.Bytes()
+			}
+			code, resp := post("secret", body, gzipped)
+			assert.Equal(t, http.StatusOK, code)
+			assert.Equal(t, "ed4acda5-034f-9f42-bba1-f29aea6d7d8f", resp.RequestID)
+			assert.Empty(t, resp.ErrorMessage)
+		}
+
+		// only known instance, the latest event; both events are buffered once
+		c.rw.RLock()
+		defer c.rw.RUnlock()
+		require.Len(t, c.samples, 1)
+		s := c.samples["db-QXZYJIL5GR3CBQ4XNCYU2AI5PE"]
+		require.NotNil(t, s)
+		assert.Equal(t, "autotest-mysql-57", s.instance.Instance)
+		assert.Equal(t, time.Date(2020, 12, 6, 10, 34, 0, 0, time.UTC), s.timestamp)
+		assert.NotEmpty(t, s.metrics)
+		assert.Nil(t, s.earlier)
+
+		var timestamps []time.Time
+		for _, s := range c.buffers["db-QXZYJIL5GR3CBQ4XNCYU2AI5PE"].all() {
+			timestamps = append(timestamps, s.timestamp)
+		}
+		expected := []time.Time{time.Date(2020, 12, 6, 10, 33, 0, 0, time.UTC), time.Date(2020, 12, 6, 10, 34, 0, 0, time.UTC)}
+		assert.Equal(t, expected, timestamps)
+	})
+}
+
+func TestFirehoseCounters(t *testing.T) {
+	fake := fakeaws.New(t)
+	cfg := fake.LoadConfig(t, "../config.tests.yml")
+	fake.SetInstance(fakeaws.Instance{
+		Region:             "us-west-2",
+		Instance:           "autotest-mysql-57",
+		ResourceID:         "db-QXZYJIL5GR3CBQ4XNCYU2AI5PE",
+		Engine:             "mysql",
+		MonitoringInterval: 5,
+	})
+	sess, err := sessions.New(cfg.Instances[2:3], client.New().HTTP(), false)
+	require.NoError(t, err)
+
+	message := readTestDataJSON(t, "mysql-57")
+	m, err := parseOSMetrics(message, true)
+	require.NoError(t, err)
+	var compact bytes.Buffer
+	require.NoError(t, json.Compact(&compact, message))
+
+	// buffering is disabled
+	c := NewCollector(sess, Options{Ingestion: IngestionFirehose})
+	h := c.FirehoseHandler("secret")
+
+	// each delivery contains events of the last 60 seconds, 5 seconds apart
+	deliver := func(last time.Time) {
+		var events []map[string]interface{}
+		for ts := last.Add(-55 * time.Second); !ts.After(last); ts = ts.Add(5 * time.Second) {
+			ms := ts.UnixNano() / int64(time.Millisecond)
+			events = append(events, map[string]interface{}{"id": fmt.Sprint(ms), "timestamp": ms, "message": compact.String()})
+		}
+
+		var data bytes.Buffer
+		gw := gzip.NewWriter(&data)
+		require.NoError(t, json.NewEncoder(gw).Encode(map[string]interface{}{
+			"messageType": "DATA_MESSAGE",
+			"logGroup":    "RDSOSMetrics",
+			"logStream":   "db-QXZYJIL5GR3CBQ4XNCYU2AI5PE",
+			"logEvents":   events,
+		}))
+		require.NoError(t, gw.Close())
+		body, err := json.Marshal(map[string]interface{}{
+			"requestId": fmt.Sprint(last.Unix()),
+			"records":   []map[string][]byte{{"data": data.Bytes()}},
+		})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/firehose", bytes.NewReader(body))
+		req.Header.Set("X-Amz-Firehose-Access-Key", "secret")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, "%s", rec.Body.String())
+	}
+	received := func() float64 {
+		c.rw.RLock()
+		defer c.rw.RUnlock()
+		for _, metric := range helpers.ReadMetrics(c.samples["db-QXZYJIL5GR3CBQ4XNCYU2AI5PE"].counters) {
+			if metric.Name == "node_network_receive_bytes_total" && metric.Labels["device"] == "eth0" {
+				return metric.Value
+			}
+		}
+		return 0
+	}
+
+	// three deliveries 60 seconds apart
+	start := time.Now().Add(-2 * time.Minute).Truncate(time.Second)
+	deliver(start)
+	first := received()
+	deliver(start.Add(time.Minute))
+	second := received()
+	deliver(start.Add(2 * time.Minute))
+	third := received()
+
+	assert.InDelta(t, 55*m.Network[0].Rx, first, 0.001)
+	assert.InDelta(t, 115*m.Network[0].Rx, second, 0.001)
+	assert.InDelta(t, 175*m.Network[0].Rx, third, 0.001)
+}
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -37,9 +39,9 @@ type osMetrics struct {
 	ProcessList       []processList     `json:"processList"`
 	Swap              swap              `json:"swap"`
 	Tasks             tasks             `json:"tasks"`
+	PhysicalDeviceIO  []diskIO          `json:"physicalDeviceIO"` // non-Aurora only
 
-	// TODO Handle this: https://jira.percona.com/browse/PMM-3835
-	PhysicalDeviceIO []diskIO `json:"physicalDeviceIO"`
+	windows *windowsMetrics // SQL Server only
 }
 
 type cpuUtilization struct {
@@ -161,15 +163,73 @@ type tasks struct {
 	Zombie   int `json:"zombie"   help:"The number of child tasks that are inactive with an active parent task."`
 }
 
+// event represents Enhanced Monitoring event in either Linux or SQL Server format.
+// Sections with the same name but different formats are kept raw until the engine is known.
+type event struct {
+	osMetrics
+
+	CPUUtilization json.RawMessage `json:"cpuUtilization"`
+	Memory         json.RawMessage `json:"memory"`
+	Network        json.RawMessage `json:"network"`
+	ProcessList    json.RawMessage `json:"processList"`
+
+	// SQL Server only
+	Disks  []windowsDisk   `json:"disks"`
+	System json.RawMessage `json:"system"`
+}
+
 // parseOSMetrics parses OS metrics from given JSON data.
 func parseOSMetrics(b []byte, disallowUnknownFields bool) (*osMetrics, error) {
-	d := json.NewDecoder(bytes.NewReader(b))
-	if disallowUnknownFields {
-		d.DisallowUnknownFields()
+	decode := func(b []byte, v interface{}) error {
+		d := json.NewDecoder(bytes.NewReader(b))
+		if disallowUnknownFields {
+			d.DisallowUnknownFields()
+		}
+		return d.Decode(v)
 	}
 
-	var m osMetrics
-	if err := d.Decode(&m); err != nil {
+	var e event
+	if err := decode(b, &e); err != nil {
+		return nil, err
+	}
+
+	// decode raw sections into format-specific structures
+	sections := func(targets ...interface{}) error {
+		raws := []json.RawMessage{e.CPUUtilization, e.Memory, e.Network, e.ProcessList, e.System}
+		for i, target := range targets {
+			if len(raws[i]) == 0 {
+				continue
+			}
+			if err := decode(raws[i], target); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// SQL Server instances use a different format
+	if isWindowsEngine(e.Engine) {
+		w := windowsMetrics{
+			Engine:             e.Engine,
+			InstanceID:         e.InstanceID,
+			InstanceResourceID: e.InstanceResourceID,
+			NumVCPUs:           e.NumVCPUs,
+			Timestamp:          e.Timestamp,
+			Uptime:             e.Uptime,
+			Version:            e.Version,
+			Disks:              e.Disks,
+		}
+		if err := sections(&w.CPUUtilization, &w.Memory, &w.Network, &w.ProcessList, &w.System); err != nil {
+			return nil, err
+		}
+		return w.osMetrics(), nil
+	}
+
+	if disallowUnknownFields && (e.Disks != nil || e.System != nil) {
+		return nil, fmt.Errorf("unexpected SQL Server sections for %q engine", e.Engine)
+	}
+	m := e.osMetrics
+	if err := sections(&m.CPUUtilization, &m.Memory, &m.Network, &m.ProcessList); err != nil {
 		return nil, err
 	}
 	return &m, nil
@@ -206,7 +266,7 @@ func makeGenericMetrics(s interface{}, namePrefix string, constLabels prometheus
 	for i := 0; i < t.NumField(); i++ {
 		tags := t.Field(i).Tag
 		name, help := tags.Get("json"), tags.Get("help")
-		desc := prometheus.NewDesc(namePrefix+name, help, nil, constLabels)
+		desc := newDesc(namePrefix+name, help, nil, constLabels)
 		m := makeGauge(desc, nil, v.Field(i))
 		if m != nil {
 			res = append(res, m)
@@ -227,7 +287,7 @@ func makeNodeCPUMetrics(s *cpuUtilization, constLabels prometheus.Labels) []prom
 	t := reflect.TypeOf(*s)
 	v := reflect.ValueOf(*s)
 	res := make([]prometheus.Metric, 0, t.NumField())
-	desc := prometheus.NewDesc("node_cpu_average", "The percentage of CPU utilization.", []string{"mode"}, labels)
+	desc := newDesc("node_cpu_average", "The percentage of CPU utilization.", []string{"mode"}, labels)
 	for i := 0; i < t.NumField(); i++ {
 		tags := t.Field(i).Tag
 		mode := tags.Get("json")
@@ -239,8 +299,8 @@ func makeNodeCPUMetrics(s *cpuUtilization, constLabels prometheus.Labels) []prom
 	return res
 }
 
-// makeRDSDiskIOMetrics returns rdsosmetrics_diskIO_ metrics.
-func makeRDSDiskIOMetrics(s *diskIO, constLabels prometheus.Labels) []prometheus.Metric {
+// makeRDSDiskIOMetrics returns rdsosmetrics_diskIO_ or rdsosmetrics_physicalDeviceIO_ metrics.
+func makeRDSDiskIOMetrics(s *diskIO, namePrefix string, constLabels prometheus.Labels) []prometheus.Metric {
 	// move device name to label
 	labelKeys := []string{"device"}
 	labelValues := []string{s.Device}
@@ -254,7 +314,7 @@ func makeRDSDiskIOMetrics(s *diskIO, constLabels prometheus.Labels) []prometheus
 		if name == "device" {
 			continue
 		}
-		desc := prometheus.NewDesc("rdsosmetrics_diskIO_"+name, help, labelKeys, constLabels)
+		desc := newDesc(namePrefix+name, help, labelKeys, constLabels)
 		m := makeGauge(desc, labelValues, v.Field(i))
 		if m != nil {
 			res = append(res, m)
@@ -271,12 +331,12 @@ func makeNodeDiskMetrics(s *diskIO, constLabels prometheus.Labels) []prometheus.
 	res := make([]prometheus.Metric, 0, 2)
 
 	if s.ReadKb != nil {
-		desc := prometheus.NewDesc("node_disk_read_bytes_total", "The total number of bytes read successfully.", labelKeys, constLabels)
+		desc := newDesc("node_disk_read_bytes_total", "The total number of bytes read successfully.", labelKeys, constLabels)
 		m := prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(*s.ReadKb*1024), labelValues...)
 		res = append(res, m)
 	}
 	if s.WriteKb != nil {
-		desc := prometheus.NewDesc("node_disk_written_bytes_total", "The total number of bytes written successfully.", labelKeys, constLabels)
+		desc := newDesc("node_disk_written_bytes_total", "The total number of bytes written successfully.", labelKeys, constLabels)
 		m := prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(*s.WriteKb*1024), labelValues...)
 		res = append(res, m)
 	}
@@ -300,7 +360,7 @@ func makeRDSFileSysMetrics(s *fileSys, constLabels prometheus.Labels) []promethe
 		case "name", "mountPoint":
 			continue
 		}
-		desc := prometheus.NewDesc("rdsosmetrics_fileSys_"+name, help, labelKeys, constLabels)
+		desc := newDesc("rdsosmetrics_fileSys_"+name, help, labelKeys, constLabels)
 		m := makeGauge(desc, labelValues, v.Field(i))
 		if m != nil {
 			res = append(res, m)
@@ -316,17 +376,17 @@ func makeNodeFilesystemMetrics(s *fileSys, constLabels prometheus.Labels) []prom
 	labelValues := []string{s.Name, s.Name, s.MountPoint}
 	res := make([]prometheus.Metric, 0, 5)
 
-	desc := prometheus.NewDesc("node_filesystem_files", "Filesystem total file nodes.", labelKeys, constLabels)
+	desc := newDesc("node_filesystem_files", "Filesystem total file nodes.", labelKeys, constLabels)
 	res = append(res, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(s.MaxFiles*1024), labelValues...))
-	desc = prometheus.NewDesc("node_filesystem_files_free", "Filesystem total free file nodes.", labelKeys, constLabels)
+	desc = newDesc("node_filesystem_files_free", "Filesystem total free file nodes.", labelKeys, constLabels)
 	res = append(res, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64((s.MaxFiles-s.UsedFiles)*1024), labelValues...))
 
 	// report the same value for node_filesystem_free and node_filesystem_avail because we use both metrics in our dashboards
-	desc = prometheus.NewDesc("node_filesystem_size_bytes", "Filesystem size in bytes.", labelKeys, constLabels)
+	desc = newDesc("node_filesystem_size_bytes", "Filesystem size in bytes.", labelKeys, constLabels)
 	res = append(res, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(s.Total*1024), labelValues...))
-	desc = prometheus.NewDesc("node_filesystem_free_bytes", "Filesystem free space in bytes.", labelKeys, constLabels)
+	desc = newDesc("node_filesystem_free_bytes", "Filesystem free space in bytes.", labelKeys, constLabels)
 	res = append(res, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64((s.Total-s.Used)*1024), labelValues...))
-	desc = prometheus.NewDesc("node_filesystem_avail_bytes", "Filesystem space available to non-root users in bytes.", labelKeys, constLabels)
+	desc = newDesc("node_filesystem_avail_bytes", "Filesystem space available to non-root users in bytes.", labelKeys, constLabels)
 	res = append(res, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64((s.Total-s.Used)*1024), labelValues...))
 
 	return res
@@ -334,7 +394,7 @@ func makeNodeFilesystemMetrics(s *fileSys, constLabels prometheus.Labels) []prom
 
 // makeNodeLoadMetrics returns node_exporter-like node_load1 metric.
 func makeNodeLoadMetrics(s *loadAverageMinute, constLabels prometheus.Labels) []prometheus.Metric {
-	desc := prometheus.NewDesc("node_load1", "The number of processes requesting CPU time over the last minute.", nil, constLabels)
+	desc := newDesc("node_load1", "The number of processes requesting CPU time over the last minute.", nil, constLabels)
 	m := prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, s.One)
 	return []prometheus.Metric{m}
 }
@@ -351,7 +411,7 @@ func makeNodeMemoryMetrics(s *memory, constLabels prometheus.Labels) []prometheu
 		if err != nil {
 			panic(err)
 		}
-		desc := prometheus.NewDesc("node_memory_"+suffix, "Memory information field "+suffix+".", nil, constLabels)
+		desc := newDesc("node_memory_"+suffix, "Memory information field "+suffix+".", nil, constLabels)
 		m := makeGauge(desc, nil, reflect.ValueOf(v.Field(i).Int()*multiplier))
 		if m != nil {
 			res = append(res, m)
@@ -375,7 +435,7 @@ func makeRDSNetworkMetrics(s *network, constLabels prometheus.Labels) []promethe
 		if name == "interface" {
 			continue
 		}
-		desc := prometheus.NewDesc("rdsosmetrics_network_"+name, help, labelKeys, constLabels)
+		desc := newDesc("rdsosmetrics_network_"+name, help, labelKeys, constLabels)
 		m := makeGauge(desc, labelValues, v.Field(i))
 		if m != nil {
 			res = append(res, m)
@@ -384,11 +444,16 @@ func makeRDSNetworkMetrics(s *network, constLabels prometheus.Labels) []promethe
 	return res
 }
 
-// makeRDSProcessListMetrics returns rdsosmetrics_processList_ metrics.
-func makeRDSProcessListMetrics(s *processList, constLabels prometheus.Labels) []prometheus.Metric {
+// makeRDSProcessListMetrics returns rdsosmetrics_processList_ metrics for a single process.
+// Process is identified by name and either rank (if it is not zero) or ID, parent ID, thread ID.
+func makeRDSProcessListMetrics(s *processList, rank int, constLabels prometheus.Labels) []prometheus.Metric {
 	// move process name, ID, parent ID, thread ID to labels
 	labelKeys := []string{"name", "id", "parentID", "tgid"}
 	labelValues := []string{s.Name, strconv.Itoa(s.ID), strconv.Itoa(s.ParentID), strconv.Itoa(s.TGID)}
+	if rank != 0 {
+		labelKeys = []string{"name", "rank"}
+		labelValues = []string{s.Name, strconv.Itoa(rank)}
+	}
 
 	t := reflect.TypeOf(*s)
 	v := reflect.ValueOf(*s)
@@ -404,7 +469,7 @@ func makeRDSProcessListMetrics(s *processList, constLabels prometheus.Labels) []
 		case "name", "id", "parentID", "tgid":
 			continue
 		}
-		desc := prometheus.NewDesc("rdsosmetrics_processList_"+name, help, labelKeys, constLabels)
+		desc := newDesc("rdsosmetrics_processList_"+name, help, labelKeys, constLabels)
 		m := makeGauge(desc, labelValues, v.Field(i))
 		if m != nil {
 			res = append(res, m)
@@ -425,7 +490,7 @@ func makeNodeMemorySwapMetrics(s *swap, constLabels prometheus.Labels) []prometh
 		if err != nil {
 			panic(err)
 		}
-		desc := prometheus.NewDesc(name, help, nil, constLabels)
+		desc := newDesc(name, help, nil, constLabels)
 		m := makeGauge(desc, nil, reflect.ValueOf(v.Field(i).Float()*multiplier))
 		if m != nil {
 			res = append(res, m)
@@ -437,20 +502,48 @@ func makeNodeMemorySwapMetrics(s *swap, constLabels prometheus.Labels) []prometh
 // makeNodeProcsMetrics returns node_exporter-like node_procs_ metrics.
 func makeNodeProcsMetrics(s *tasks, constLabels prometheus.Labels) []prometheus.Metric {
 	res := make([]prometheus.Metric, 0, 2)
-	desc := prometheus.NewDesc("node_procs_blocked", "Number of processes blocked waiting for I/O to complete.", nil, constLabels)
+	desc := newDesc("node_procs_blocked", "Number of processes blocked waiting for I/O to complete.", nil, constLabels)
 	res = append(res, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(s.Blocked)))
-	desc = prometheus.NewDesc("node_procs_running", "Number of processes in runnable state.", nil, constLabels)
+	desc = newDesc("node_procs_running", "Number of processes in runnable state.", nil, constLabels)
 	res = append(res, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(s.Running)))
 	return res
 }
 
-// makePrometheusMetrics returns all Prometheus metrics for given osMetrics.
-func (m *osMetrics) makePrometheusMetrics(region string, labels map[string]string) []prometheus.Metric {
-	res := make([]prometheus.Metric, 0, 100)
+// uptimeRE matches uptime in formats like "01:45:58", "1 day, 07:11:58", or "332 days, 01:07:34".
+var uptimeRE = regexp.MustCompile(`^(?:(\d+) days?,\s*)?(\d+):(\d{2}):(\d{2})$`)
+
+// parseUptime parses Enhanced Monitoring uptime string.
+func parseUptime(s string) (time.Duration, error) {
+	m := uptimeRE.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("failed to parse uptime %q", s)
+	}
+
+	var days, hours, minutes, seconds int64
+	for i, p := range []*int64{&days, &hours, &minutes, &seconds} {
+		if m[i+1] == "" {
+			continue
+		}
+		v, err := strconv.ParseInt(m[i+1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse uptime %q: %s", s, err)
+		}
+		*p = v
+	}
+	if minutes >= 60 || seconds >= 60 {
+		return 0, fmt.Errorf("failed to parse uptime %q", s)
+	}
+
+	d := time.Duration(days)*24*time.Hour + time.Duration(hours)*time.Hour
+	d += time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second
+	return d, nil
+}
 
+// makeConstLabels returns region and instance labels with added or overridden (or removed, for empty values) user labels.
+func makeConstLabels(region, instance string, labels map[string]string) prometheus.Labels {
 	constLabels := prometheus.Labels{
 		"region":   region,
-		"instance": m.InstanceID,
+		"instance": instance,
 	}
 	for n, v := range labels {
 		if v == "" {
@@ -459,21 +552,72 @@ func (m *osMetrics) makePrometheusMetrics(region string, labels map[string]strin
 			constLabels[n] = v
 		}
 	}
+	return constLabels
+}
+
+// newDesc is prometheus.NewDesc that ignores constant labels with the same names as variable labels:
+// configured and tag labels like "name" or "device" must not make enhanced metrics invalid.
+func newDesc(fqName, help string, variableLabels []string, constLabels prometheus.Labels) *prometheus.Desc {
+	clashing := false
+	for _, name := range variableLabels {
+		if _, ok := constLabels[name]; ok {
+			clashing = true
+			break
+		}
+	}
+	if !clashing {
+		return prometheus.NewDesc(fqName, help, variableLabels, constLabels)
+	}
+
+	labels := make(prometheus.Labels, len(constLabels))
+	for n, v := range constLabels {
+		labels[n] = v
+	}
+	for _, name := range variableLabels {
+		delete(labels, name)
+	}
+	return prometheus.NewDesc(fqName, help, variableLabels, labels)
+}
+
+// makePrometheusMetrics returns all Prometheus metrics for given osMetrics.
+func (m *osMetrics) makePrometheusMetrics(region string, labels map[string]string, processList ProcessListOptions) []prometheus.Metric {
+	res := make([]prometheus.Metric, 0, 100)
+	constLabels := makeConstLabels(region, m.InstanceID, labels)
 
 	res = append(res, prometheus.MustNewConstMetric(
-		prometheus.NewDesc("rdsosmetrics_timestamp", "Metrics timestamp (UNIX seconds).", nil, constLabels),
+		newDesc("rdsosmetrics_timestamp", "Metrics timestamp (UNIX seconds).", nil, constLabels),
 		prometheus.CounterValue,
 		float64(m.Timestamp.Unix()),
 	))
 
-	// TODO Parse uptime: https://jira.percona.com/browse/PMM-2131
+	// skip uptime metrics for unexpected format
+	if uptime, err := parseUptime(m.Uptime); err == nil {
+		res = append(res, prometheus.MustNewConstMetric(
+			newDesc("rdsosmetrics_uptime_seconds", "The amount of time that the DB instance has been active.", nil, constLabels),
+			prometheus.GaugeValue,
+			uptime.Seconds(),
+		))
+		bootTimeDesc := newDesc("node_boot_time_seconds", "Node boot time, in unixtime.", nil, constLabels)
+		if m.windows != nil {
+			bootTimeDesc = newDesc("windows_system_system_up_time", "System boot time (WMI source: PerfOS_System.SystemUpTime)", nil, constLabels)
+		}
+		res = append(res, prometheus.MustNewConstMetric(
+			bootTimeDesc,
+			prometheus.GaugeValue,
+			float64(m.Timestamp.Add(-uptime).Unix()),
+		))
+	}
 
 	res = append(res, prometheus.MustNewConstMetric(
-		prometheus.NewDesc("rdsosmetrics_General_numVCPUs", "The number of virtual CPUs for the DB instance.", nil, constLabels),
+		newDesc("rdsosmetrics_General_numVCPUs", "The number of virtual CPUs for the DB instance.", nil, constLabels),
 		prometheus.GaugeValue,
 		float64(m.NumVCPUs)),
 	)
 
+	if m.windows != nil {
+		return append(res, m.windows.makePrometheusMetrics(constLabels, processList)...)
+	}
+
 	// always make both generic and node_exporter-like metrics
 
 	metrics := makeGenericMetrics(m.CPUUtilization, "rdsosmetrics_cpuUtilization_", constLabels)
@@ -482,7 +626,15 @@ func (m *osMetrics) makePrometheusMetrics(region string, labels map[string]strin
 	res = append(res, metrics...)
 
 	for _, disk := range m.DiskIO {
-		metrics = makeRDSDiskIOMetrics(&disk, constLabels)
+		metrics = makeRDSDiskIOMetrics(&disk, "rdsosmetrics_diskIO_", constLabels)
+		res = append(res, metrics...)
+		metrics = makeNodeDiskMetrics(&disk, constLabels)
+		res = append(res, metrics...)
+	}
+
+	// physical devices have names different from logical ones (like "xvdg" vs "rdsdev")
+	for _, disk := range m.PhysicalDeviceIO {
+		metrics = makeRDSDiskIOMetrics(&disk, "rdsosmetrics_physicalDeviceIO_", constLabels)
 		res = append(res, metrics...)
 		metrics = makeNodeDiskMetrics(&disk, constLabels)
 		res = append(res, metrics...)
@@ -508,14 +660,12 @@ func (m *osMetrics) makePrometheusMetrics(region string, labels map[string]strin
 	for _, n := range m.Network {
 		metrics = makeRDSNetworkMetrics(&n, constLabels)
 		res = append(res, metrics...)
-		// we can't make node_exporter-like metrics: AWS gives us rates, node_exporter - total counters
+		// node_exporter-like counters are synthesized from rates by Collector, see makeCounterRates
 	}
 
-	for _, p := range m.ProcessList {
-		metrics = makeRDSProcessListMetrics(&p, constLabels)
-		res = append(res, metrics...)
-		// no node_exporter-like metrics
-	}
+	// no node_exporter-like metrics for processes
+	metrics = makeProcessListMetrics(m.ProcessList, processList, constLabels)
+	res = append(res, metrics...)
 
 	metrics = makeGenericMetrics(m.Swap, "rdsosmetrics_swap_", constLabels)
 	res = append(res, metrics...)
@@ -3,8 +3,10 @@ package enhanced
 import (
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/percona/exporter_shared/helpers"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -18,6 +20,7 @@ func TestParse(t *testing.T) {
 		{"us-west-1", "psql-10"},
 		{"us-west-2", "mysql-57"},
 		{"us-west-2", "aurora-psql-11"},
+		{"eu-west-1", "sqlserver-2019"},
 	} {
 		data := data
 		t.Run(data.instance, func(t *testing.T) {
@@ -26,7 +29,7 @@ func TestParse(t *testing.T) {
 			m, err := parseOSMetrics(readTestDataJSON(t, data.instance), true)
 			require.NoError(t, err)
 
-			actualMetrics := helpers.ReadMetrics(m.makePrometheusMetrics(data.region, nil))
+			actualMetrics := helpers.ReadMetrics(m.makePrometheusMetrics(data.region, nil, ProcessListOptions{}))
 			sort.Slice(actualMetrics, func(i, j int) bool { return actualMetrics[i].Less(actualMetrics[j]) })
 			actualLines := helpers.Format(helpers.WriteMetrics(actualMetrics))
 
@@ -45,9 +48,62 @@ func TestParse(t *testing.T) {
 	}
 }
 
+func TestParseClashingLabels(t *testing.T) {
+	// configured or tag labels with the same names as variable labels must not make metrics invalid
+	labels := map[string]string{"name": "tag", "device": "tag", "cpu": "tag", "core": "tag", "team": "dba"}
+	for _, instance := range []string{"psql-10", "sqlserver-2019"} {
+		m, err := parseOSMetrics(readTestDataJSON(t, instance), true)
+		require.NoError(t, err)
+
+		metrics := m.makePrometheusMetrics("us-east-1", labels, ProcessListOptions{})
+		for _, r := range m.makeCounterRates("us-east-1", labels) {
+			metrics = append(metrics, prometheus.MustNewConstMetric(r.desc, prometheus.CounterValue, r.rate, r.labelValues...))
+		}
+		require.NotEmpty(t, metrics)
+		for _, metric := range helpers.ReadMetrics(metrics) {
+			assert.Equal(t, "dba", metric.Labels["team"], "%s", metric.Name)
+			switch metric.Name {
+			case "node_cpu_seconds_total":
+				assert.NotEqual(t, "tag", metric.Labels["cpu"], "%s", metric.Name)
+			case "node_network_receive_bytes_total":
+				assert.NotEqual(t, "tag", metric.Labels["device"], "%s", metric.Name)
+			case "rdsosmetrics_processList_memoryUsedPc":
+				assert.NotEqual(t, "tag", metric.Labels["name"], "%s", metric.Name)
+			case "windows_cpu_time_total":
+				assert.Equal(t, "All", metric.Labels["core"], "%s", metric.Name)
+			}
+		}
+	}
+}
+
 func TestParseUptime(t *testing.T) {
-	t.Skip("TODO Parse uptime https://jira.percona.com/browse/PMM-2131")
+	for s, expected := range map[string]time.Duration{
+		"00:00:05":            5 * time.Second,
+		"01:45:58":            time.Hour + 45*time.Minute + 58*time.Second,
+		"1 day, 07:11:58":     31*time.Hour + 11*time.Minute + 58*time.Second,
+		"332 days, 01:07:34":  332*24*time.Hour + time.Hour + 7*time.Minute + 34*time.Second,
+		" 2 days,  00:00:00 ": 48 * time.Hour,
+	} {
+		actual, err := parseUptime(s)
+		assert.NoError(t, err, "%q", s)
+		assert.Equal(t, expected, actual, "%q", s)
+	}
+
+	for _, s := range []string{"", "1 day", "01:45", "1 week, 01:45:58", "01:60:00", "-01:45:58"} {
+		_, err := parseUptime(s)
+		assert.Error(t, err, "%q", s)
+	}
+}
+
+func TestParseOSMetricsStrict(t *testing.T) {
+	_, err := parseOSMetrics([]byte(`{"engine": "MYSQL", "memory": {"foo": 1}}`), true)
+	assert.EqualError(t, err, `json: unknown field "foo"`)
+
+	_, err = parseOSMetrics([]byte(`{"engine": "MYSQL", "system": {}}`), true)
+	assert.EqualError(t, err, `unexpected SQL Server sections for "MYSQL" engine`)
 
-	_ = "01:45:58"
-	_ = "1 day, 07:11:58"
+	m, err := parseOSMetrics([]byte(`{"engine": "SQLSERVER", "memory": {"commitTotKb": 42}}`), true)
+	require.NoError(t, err)
+	require.NotNil(t, m.windows)
+	assert.Equal(t, 42, m.windows.Memory.CommitTotKb)
 }
@@ -0,0 +1,138 @@
+package enhanced
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ProcessListMode configures how rdsosmetrics_processList_ metrics are exposed.
+type ProcessListMode string
+
+// Process list modes.
+const (
+	ProcessListAll       ProcessListMode = "all"        // all processes
+	ProcessListOff       ProcessListMode = "off"        // no processes
+	ProcessListTopCPU    ProcessListMode = "top-cpu"    // top-N processes by CPU usage
+	ProcessListTopMemory ProcessListMode = "top-memory" // top-N processes by memory usage
+	ProcessListByName    ProcessListMode = "name"       // processes aggregated by name
+)
+
+// ProcessListModes contains all valid process list modes.
+var ProcessListModes = []ProcessListMode{
+	ProcessListAll, ProcessListOff, ProcessListTopCPU, ProcessListTopMemory, ProcessListByName,
+}
+
+// DefaultProcessListTopN is the default value of ProcessListOptions.TopN.
+const DefaultProcessListTopN = 10
+
+// ProcessListOptions configures rdsosmetrics_processList_ metrics.
+type ProcessListOptions struct {
+	// Mode is a process list mode. Zero value means ProcessListAll.
+	Mode ProcessListMode
+
+	// TopN is the number of processes for top modes. Zero value means DefaultProcessListTopN.
+	TopN int
+
+	// NoPIDLabels replaces process ID, parent ID and thread ID labels with a rank label:
+	// process position by CPU usage (or by memory usage for ProcessListTopMemory mode).
+	NoPIDLabels bool
+}
+
+// makeProcessListMetrics returns rdsosmetrics_processList_ metrics for given processes and options.
+func makeProcessListMetrics(list []processList, opts ProcessListOptions, constLabels prometheus.Labels) []prometheus.Metric {
+	topN := opts.TopN
+	if topN <= 0 {
+		topN = DefaultProcessListTopN
+	}
+
+	switch opts.Mode {
+	case ProcessListOff:
+		return nil
+	case ProcessListByName:
+		return makeProcessListByNameMetrics(list, constLabels)
+	case ProcessListTopMemory:
+		list = sortProcessList(list, func(p *processList) float64 { return p.MemoryUsedPC })
+		if len(list) > topN {
+			list = list[:topN]
+		}
+	case ProcessListTopCPU:
+		list = sortProcessList(list, func(p *processList) float64 { return p.CPUUsedPC })
+		if len(list) > topN {
+			list = list[:topN]
+		}
+	default:
+		if opts.NoPIDLabels {
+			list = sortProcessList(list, func(p *processList) float64 { return p.CPUUsedPC })
+		}
+	}
+
+	res := make([]prometheus.Metric, 0, len(list)*5)
+	for i, p := range list {
+		var rank int
+		if opts.NoPIDLabels {
+			rank = i + 1
+		}
+		res = append(res, makeRDSProcessListMetrics(&p, rank, constLabels)...)
+	}
+	return res
+}
+
+// sortProcessList returns a copy of given processes sorted by descending key, then by ID.
+func sortProcessList(list []processList, key func(*processList) float64) []processList {
+	res := make([]processList, len(list))
+	copy(res, list)
+	sort.SliceStable(res, func(i, j int) bool {
+		if ki, kj := key(&res[i]), key(&res[j]); ki != kj {
+			return ki > kj
+		}
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+// makeProcessListByNameMetrics returns rdsosmetrics_processList_ metrics aggregated by process name.
+//
+//nolint:lll
+func makeProcessListByNameMetrics(list []processList, constLabels prometheus.Labels) []prometheus.Metric {
+	type aggregate struct {
+		count                   int
+		cpuUsedPC, memoryUsedPC float64
+		rss, vss                int
+	}
+	var names []string
+	aggregates := make(map[string]*aggregate)
+	for _, p := range list {
+		a := aggregates[p.Name]
+		if a == nil {
+			a = new(aggregate)
+			aggregates[p.Name] = a
+			names = append(names, p.Name)
+		}
+		a.count++
+		a.cpuUsedPC += p.CPUUsedPC
+		a.memoryUsedPC += p.MemoryUsedPC
+		a.rss += p.RSS
+		a.vss += p.VSS
+	}
+
+	labelKeys := []string{"name"}
+	countDesc := newDesc("rdsosmetrics_processList_count", "The number of processes with the same name.", labelKeys, constLabels)
+	cpuDesc := newDesc("rdsosmetrics_processList_cpuUsedPc", "The percentage of CPU used by processes with the same name.", labelKeys, constLabels)
+	memoryDesc := newDesc("rdsosmetrics_processList_memoryUsedPc", "The percentage of memory used by processes with the same name.", labelKeys, constLabels)
+	rssDesc := newDesc("rdsosmetrics_processList_rss", "The amount of RAM allocated to processes with the same name, in kilobytes.", labelKeys, constLabels)
+	vssDesc := newDesc("rdsosmetrics_processList_vss", "The amount of virtual memory allocated to processes with the same name, in kilobytes.", labelKeys, constLabels)
+
+	res := make([]prometheus.Metric, 0, len(names)*5)
+	for _, name := range names {
+		a := aggregates[name]
+		res = append(res,
+			prometheus.MustNewConstMetric(countDesc, prometheus.GaugeValue, float64(a.count), name),
+			prometheus.MustNewConstMetric(cpuDesc, prometheus.GaugeValue, a.cpuUsedPC, name),
+			prometheus.MustNewConstMetric(memoryDesc, prometheus.GaugeValue, a.memoryUsedPC, name),
+			prometheus.MustNewConstMetric(rssDesc, prometheus.GaugeValue, float64(a.rss), name),
+			prometheus.MustNewConstMetric(vssDesc, prometheus.GaugeValue, float64(a.vss), name),
+		)
+	}
+	return res
+}
@@ -0,0 +1,77 @@
+package enhanced
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/percona/exporter_shared/helpers"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessListMetrics(t *testing.T) {
+	m, err := parseOSMetrics(readTestDataJSON(t, "psql-10"), true)
+	require.NoError(t, err)
+	list := []processList{m.ProcessList[0], m.ProcessList[1], m.ProcessList[2], m.ProcessList[8]}
+	constLabels := prometheus.Labels{"instance": "autotest-psql-10"}
+
+	format := func(opts ProcessListOptions, name string) []string {
+		var res []string
+		for _, line := range helpers.Format(helpers.WriteMetrics(helpers.ReadMetrics(makeProcessListMetrics(list, opts, constLabels)))) {
+			if len(line) > 0 && line[0] != '#' && strings.HasPrefix(line, name) {
+				res = append(res, line)
+			}
+		}
+		sort.Strings(res)
+		return res
+	}
+
+	t.Run("All", func(t *testing.T) {
+		assert.Len(t, format(ProcessListOptions{}, ""), 4*4)
+		assert.Equal(t, format(ProcessListOptions{}, ""), format(ProcessListOptions{Mode: ProcessListAll}, ""))
+	})
+
+	t.Run("Off", func(t *testing.T) {
+		assert.Empty(t, format(ProcessListOptions{Mode: ProcessListOff}, ""))
+	})
+
+	t.Run("TopCPU", func(t *testing.T) {
+		// ties are broken by process ID
+		expected := []string{
+			`rdsosmetrics_processList_cpuUsedPc{id="0",instance="autotest-psql-10",name="OS processes",parentID="0",tgid="0"} 0.02`,
+			`rdsosmetrics_processList_cpuUsedPc{id="0",instance="autotest-psql-10",name="RDS processes",parentID="0",tgid="0"} 1.25`,
+		}
+		actual := format(ProcessListOptions{Mode: ProcessListTopCPU, TopN: 2}, "rdsosmetrics_processList_cpuUsedPc")
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("TopMemoryRank", func(t *testing.T) {
+		expected := []string{
+			`rdsosmetrics_processList_memoryUsedPc{instance="autotest-psql-10",name="OS processes",rank="2"} 3.57`,
+			`rdsosmetrics_processList_memoryUsedPc{instance="autotest-psql-10",name="RDS processes",rank="1"} 23.68`,
+			`rdsosmetrics_processList_memoryUsedPc{instance="autotest-psql-10",name="postgres",rank="3"} 2.39`,
+		}
+		actual := format(ProcessListOptions{Mode: ProcessListTopMemory, TopN: 3, NoPIDLabels: true}, "rdsosmetrics_processList_memoryUsedPc")
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("ByName", func(t *testing.T) {
+		list = append(list, processList{Name: "postgres", ID: 42, CPUUsedPC: 1, MemoryUsedPC: 0.5, RSS: 100, VSS: 200})
+		expected := []string{
+			`rdsosmetrics_processList_count{instance="autotest-psql-10",name="postgres"} 2`,
+			`rdsosmetrics_processList_cpuUsedPc{instance="autotest-psql-10",name="postgres"} 1`,
+			`rdsosmetrics_processList_memoryUsedPc{instance="autotest-psql-10",name="postgres"} 2.89`,
+			`rdsosmetrics_processList_rss{instance="autotest-psql-10",name="postgres"} 24448`,
+			`rdsosmetrics_processList_vss{instance="autotest-psql-10",name="postgres"} 346132`,
+		}
+		var actual []string
+		for _, line := range format(ProcessListOptions{Mode: ProcessListByName}, "rdsosmetrics_processList_") {
+			if strings.Contains(line, `name="postgres"}`) {
+				actual = append(actual, line)
+			}
+		}
+		assert.Equal(t, expected, actual)
+	})
+}
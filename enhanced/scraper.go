@@ -3,6 +3,8 @@ package enhanced
 import (
 	"context"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -11,78 +13,138 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/log"
 
+	"github.com/percona/rds_exporter/health"
 	"github.com/percona/rds_exporter/sessions"
 )
 
 // scraper retrieves metrics from several RDS instances sharing a single session.
 type scraper struct {
-	instances      []sessions.Instance
+	instancesM     sync.RWMutex
+	instances      []sessions.Instance // may be updated with the same resource IDs, see setInstances
 	logStreamNames []string
 	svc            *cloudwatchlogs.CloudWatchLogs
-	nextStartTime  time.Time
+	nextStartTimes map[string]time.Time // ResourceID -> StartTime for the next request
+	health         *health.Tracker
 	logger         log.Logger
+	processList    ProcessListOptions
 
 	testDisallowUnknownFields bool // for tests only
 }
 
-func newScraper(session *session.Session, instances []sessions.Instance) *scraper {
+// maxLookback is the maximal age of requested events.
+const maxLookback = 3 * time.Minute
+
+func newScraper(session *session.Session, instances []sessions.Instance, health *health.Tracker) *scraper {
 	logStreamNames := make([]string, 0, len(instances))
+	nextStartTimes := make(map[string]time.Time, len(instances))
+	startTime := time.Now().Add(-maxLookback).Round(0) // strip monotonic clock reading
 	for _, instance := range instances {
 		logStreamNames = append(logStreamNames, instance.ResourceID)
+		nextStartTimes[instance.ResourceID] = startTime
 	}
 
 	return &scraper{
 		instances:      instances,
 		logStreamNames: logStreamNames,
 		svc:            cloudwatchlogs.New(session),
-		nextStartTime:  time.Now().Add(-3 * time.Minute).Round(0), // strip monotonic clock reading
+		nextStartTimes: nextStartTimes,
+		health:         health,
 		logger:         log.With("component", "enhanced"),
 	}
 }
 
-// start scrapes metrics in loop and sends them to the channel until context is canceled.
-func (s *scraper) start(ctx context.Context, interval time.Duration, ch chan<- map[string][]prometheus.Metric) {
+// setInstances replaces scraper's instances with given ones with the same resource IDs
+// (for example, with updated labels).
+func (s *scraper) setInstances(instances []sessions.Instance) {
+	s.instancesM.Lock()
+	s.instances = instances
+	s.instancesM.Unlock()
+}
+
+// start scrapes metrics immediately and then in loop, and sends them to the channel until context is canceled.
+// Channel is closed on return.
+func (s *scraper) start(ctx context.Context, interval time.Duration, ch chan<- map[string]*sample) {
+	defer close(ch)
+
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
+		scrapeCtx, cancel := context.WithTimeout(ctx, interval)
+		m := s.scrape(scrapeCtx)
+		cancel()
+
+		select {
+		case ch <- m:
+		case <-ctx.Done():
+			return
+		}
+
 		select {
 		case <-ticker.C:
 			// nothing
 		case <-ctx.Done():
 			return
 		}
+	}
+}
 
-		scrapeCtx, cancel := context.WithTimeout(ctx, interval)
-		m, _ := s.scrape(scrapeCtx)
-		cancel()
-		ch <- m
+// sample represents metrics made from a single Enhanced Monitoring event.
+type sample struct {
+	instance  sessions.Instance
+	timestamp time.Time // event timestamp
+	metrics   []prometheus.Metric
+	rates     []counterRate       // integrated by Collector into counters
+	counters  []prometheus.Metric // set by Collector
+	message   string
+	earlier   []*sample // earlier samples of the same scrape or delivery, oldest first
+}
+
+// makeSample returns a sample for given instance and event.
+func (m *osMetrics) makeSample(instance sessions.Instance, timestamp time.Time, message string, processList ProcessListOptions) *sample {
+	return &sample{
+		instance:  instance,
+		timestamp: timestamp,
+		metrics:   m.makePrometheusMetrics(instance.Region, instance.AllLabels(), processList),
+		rates:     m.makeCounterRates(instance.Region, instance.AllLabels()),
+		message:   message,
 	}
 }
 
-// scrape performs a single scrape.
-func (s *scraper) scrape(ctx context.Context) (map[string][]prometheus.Metric, map[string]string) {
+// scrape performs a single scrape and returns the latest sample for each instance (keyed by ResourceID).
+func (s *scraper) scrape(ctx context.Context) map[string]*sample {
+	allSamples := make(map[string]map[time.Time]*sample) // ResourceID -> event timestamp -> sample
+
+	s.instancesM.RLock()
+	instances := s.instances
+	s.instancesM.RUnlock()
 
-	allMetrics := make(map[string]map[time.Time][]prometheus.Metric) // ResourceID -> event timestamp -> metrics
-	allMessages := make(map[string]map[time.Time]string)             // ResourceID -> event timestamp -> message
+	// Request uses the earliest StartTime of its streams, so sort streams by StartTime
+	// to prevent a lagging stream from moving StartTime back for many others.
+	logStreamNames := make([]string, len(s.logStreamNames))
+	copy(logStreamNames, s.logStreamNames)
+	sort.SliceStable(logStreamNames, func(i, j int) bool {
+		return s.nextStartTimes[logStreamNames[i]].Before(s.nextStartTimes[logStreamNames[j]])
+	})
 
 	// LogStreamNames parameter supports up to 100 items.
 	// https://docs.aws.amazon.com/AmazonCloudWatchLogs/latest/APIReference/API_FilterLogEvents.html
-	streamCount := len(s.logStreamNames)
+	streamCount := len(logStreamNames)
 	for i := 0; i < streamCount; i += 100 {
 		sliceStart := i
 		sliceEnd := i + 100
 		if sliceEnd > streamCount {
 			sliceEnd = streamCount
 		}
+		startTime := s.nextStartTimes[logStreamNames[sliceStart]]
 
 		input := &cloudwatchlogs.FilterLogEventsInput{
 			LogGroupName:   aws.String("RDSOSMetrics"),
-			LogStreamNames: aws.StringSlice(s.logStreamNames[sliceStart:sliceEnd]),
-			StartTime:      aws.Int64(aws.TimeUnixMilli(s.nextStartTime)),
+			LogStreamNames: aws.StringSlice(logStreamNames[sliceStart:sliceEnd]),
+			StartTime:      aws.Int64(aws.TimeUnixMilli(startTime)),
 		}
 
-		s.logger.With("next_start", s.nextStartTime.UTC()).With("since_last", time.Since(s.nextStartTime)).Debugf("Requesting metrics")
+		s.logger.With("next_start", startTime.UTC()).With("since_last", time.Since(startTime)).Debugf("Requesting metrics")
 
 		// collect all returned events and metrics/messages
 		collectAllMetrics := func(output *cloudwatchlogs.FilterLogEventsOutput, lastPage bool) bool {
@@ -92,7 +154,7 @@ func (s *scraper) scrape(ctx context.Context) (map[string][]prometheus.Metric, m
 				l = l.With("IngestionTime", aws.MillisecondsTimeValue(event.IngestionTime).UTC())
 
 				var instance *sessions.Instance
-				for _, i := range s.instances {
+				for _, i := range instances {
 					if i.ResourceID == *event.LogStreamName {
 						instance = &i
 						break
@@ -109,6 +171,13 @@ func (s *scraper) scrape(ctx context.Context) (map[string][]prometheus.Metric, m
 				}
 				l = l.With("region", instance.Region).With("instance", instance.Instance)
 
+				// skip events that are older than stream's StartTime
+				timestamp := aws.MillisecondsTimeValue(event.Timestamp).UTC()
+				if timestamp.Before(s.nextStartTimes[instance.ResourceID]) {
+					l.Debugf("Skipping old event.")
+					continue
+				}
+
 				// l.Debugf("Message:\n%s", *event.Message)
 				osMetrics, err := parseOSMetrics([]byte(*event.Message), s.testDisallowUnknownFields)
 				if err != nil {
@@ -122,52 +191,77 @@ func (s *scraper) scrape(ctx context.Context) (map[string][]prometheus.Metric, m
 				}
 				// l.Debugf("OS Metrics:\n%#v", osMetrics)
 
-				timestamp := aws.MillisecondsTimeValue(event.Timestamp).UTC()
 				l.Debugf("Timestamp from message: %s; from event: %s.", osMetrics.Timestamp.UTC(), timestamp)
 
-				if allMetrics[instance.ResourceID] == nil {
-					allMetrics[instance.ResourceID] = make(map[time.Time][]prometheus.Metric)
-				}
-				allMetrics[instance.ResourceID][timestamp] = osMetrics.makePrometheusMetrics(instance.Region, instance.Labels)
-
-				if allMessages[instance.ResourceID] == nil {
-					allMessages[instance.ResourceID] = make(map[time.Time]string)
+				if allSamples[instance.ResourceID] == nil {
+					allSamples[instance.ResourceID] = make(map[time.Time]*sample)
 				}
-				allMessages[instance.ResourceID][timestamp] = *event.Message
+				allSamples[instance.ResourceID][timestamp] = osMetrics.makeSample(*instance, timestamp, *event.Message, s.processList)
 			}
 
 			return true // continue pagination
 		}
-		if err := s.svc.FilterLogEventsPagesWithContext(ctx, input, collectAllMetrics); err != nil {
+		err := s.svc.FilterLogEventsPagesWithContext(ctx, input, collectAllMetrics)
+		if err != nil {
 			s.logger.Errorf("Failed to filter log events: %s.", err)
+			s.health.Error("enhanced", err)
+		}
+
+		// instance is up if request was successful, even if there were no events
+		for _, name := range logStreamNames[sliceStart:sliceEnd] {
+			for _, instance := range instances {
+				if instance.ResourceID != name || instance.DisableEnhancedMetrics {
+					continue
+				}
+				if err != nil {
+					s.health.Failure(instance)
+				} else {
+					s.health.Success(instance)
+				}
+			}
 		}
 	}
 	// get better times
 	allTimes := make(map[string][]time.Time)
-	for resourceID, events := range allMetrics {
+	for resourceID, events := range allSamples {
 		allTimes[resourceID] = make([]time.Time, 0, len(events))
 		for timestamp := range events {
 			allTimes[resourceID] = append(allTimes[resourceID], timestamp)
 		}
 	}
-	var times map[string]time.Time
-	times, s.nextStartTime = betterTimes(allTimes)
+	times := betterTimes(allTimes)
+	for resourceID, timestamp := range times {
+		s.nextStartTimes[resourceID] = timestamp
+	}
+
+	// do not request too old events for streams without recent events
+	oldest := time.Now().Add(-maxLookback).Round(0)
+	for resourceID, timestamp := range s.nextStartTimes {
+		if timestamp.Before(oldest) {
+			s.nextStartTimes[resourceID] = oldest
+		}
+	}
 
-	// return only latest metrics/messages
-	resMetrics := make(map[string][]prometheus.Metric) // ResourceID -> metrics
-	resMessages := make(map[string]string)             // ResourceID -> message
+	// return latest samples with earlier ones
+	res := make(map[string]*sample, len(times))
 	for resourceID, timestamp := range times {
-		resMetrics[resourceID] = allMetrics[resourceID][timestamp]
-		resMessages[resourceID] = allMessages[resourceID][timestamp]
+		latest := allSamples[resourceID][timestamp]
+		for _, t := range allTimes[resourceID] {
+			if t.Before(timestamp) {
+				latest.earlier = append(latest.earlier, allSamples[resourceID][t])
+			}
+		}
+		sort.Slice(latest.earlier, func(i, j int) bool { return latest.earlier[i].timestamp.Before(latest.earlier[j].timestamp) })
+		res[resourceID] = latest
 	}
-	return resMetrics, resMessages
+	return res
 }
 
-// betterTimes returns timestamps of the latest metrics, and also StarTime that should be used in the next request
-func betterTimes(allTimes map[string][]time.Time) (times map[string]time.Time, nextStartTime time.Time) {
+// betterTimes returns timestamps of the latest metrics for each stream.
+// They are also used as streams' StartTime in the next request.
+func betterTimes(allTimes map[string][]time.Time) map[string]time.Time {
 	// keep only the most recent metrics for each instance
-	nextStartTime = time.Now()
-	times = make(map[string]time.Time) // ResourceID -> timestamp
+	times := make(map[string]time.Time) // ResourceID -> timestamp
 	for resourceID, events := range allTimes {
 		var newest time.Time
 		for _, timestamp := range events {
@@ -176,11 +270,6 @@ func betterTimes(allTimes map[string][]time.Time) (times map[string]time.Time, n
 				times[resourceID] = timestamp
 			}
 		}
-
-		if nextStartTime.After(newest) {
-			nextStartTime = newest
-		}
 	}
-
-	return
+	return times
 }
@@ -13,7 +13,8 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/percona/rds_exporter/client"
-	"github.com/percona/rds_exporter/config"
+	"github.com/percona/rds_exporter/fakeaws"
+	"github.com/percona/rds_exporter/health"
 	"github.com/percona/rds_exporter/sessions"
 )
 
@@ -38,8 +39,7 @@ func filterMetrics(metrics []*helpers.Metric) []*helpers.Metric {
 }
 
 func TestScraper(t *testing.T) {
-	cfg, err := config.Load("../config.tests.yml")
-	require.NoError(t, err)
+	cfg := fakeaws.New(t).LoadConfig(t, "../config.tests.yml")
 	client := client.New()
 	sess, err := sessions.New(cfg.Instances, client.HTTP(), false)
 	require.NoError(t, err)
@@ -48,11 +48,15 @@ func TestScraper(t *testing.T) {
 		session, instances := session, instances
 		t.Run(fmt.Sprint(instances), func(t *testing.T) {
 			// test that there are no new metrics
-			s := newScraper(session, instances)
+			s := newScraper(session, instances, health.NewTracker("enhanced"))
 			s.testDisallowUnknownFields = true
-			metrics, messages := s.scrape(context.Background())
-			require.Len(t, metrics, len(instances))
-			require.Len(t, messages, len(instances))
+			samples := s.scrape(context.Background())
+			require.Len(t, samples, len(instances))
+
+			// each stream has its own StartTime
+			for _, instance := range instances {
+				assert.Equal(t, samples[instance.ResourceID].timestamp, s.nextStartTimes[instance.ResourceID], "%s", instance)
+			}
 
 			for _, instance := range instances {
 				// Test that actually received JSON matches expected JSON.
@@ -61,18 +65,18 @@ func TestScraper(t *testing.T) {
 
 				instanceName := strings.TrimPrefix(instance.Instance, "autotest-")
 
-				actualMetrics := helpers.ReadMetrics(metrics[instance.ResourceID])
+				actualMetrics := helpers.ReadMetrics(samples[instance.ResourceID].metrics)
 				sort.Slice(actualMetrics, func(i, j int) bool { return actualMetrics[i].Less(actualMetrics[j]) })
 				actualMetrics = filterMetrics(actualMetrics)
 				actualLines := helpers.Format(helpers.WriteMetrics(actualMetrics))
 
 				if *golden {
-					writeTestDataJSON(t, instanceName, []byte(messages[instance.ResourceID]))
+					writeTestDataJSON(t, instanceName, []byte(samples[instance.ResourceID].message))
 				}
 
 				osMetrics, err := parseOSMetrics(readTestDataJSON(t, instanceName), true)
 				require.NoError(t, err)
-				expectedMetrics := helpers.ReadMetrics(osMetrics.makePrometheusMetrics(instance.Region, nil))
+				expectedMetrics := helpers.ReadMetrics(osMetrics.makePrometheusMetrics(instance.Region, nil, ProcessListOptions{}))
 				sort.Slice(expectedMetrics, func(i, j int) bool { return expectedMetrics[i].Less(expectedMetrics[j]) })
 				expectedMetrics = filterMetrics(expectedMetrics)
 				expectedLines := helpers.Format(helpers.WriteMetrics(expectedMetrics))
@@ -93,9 +97,8 @@ func TestScraper(t *testing.T) {
 
 func TestBetterTimes(t *testing.T) {
 	type testdata struct {
-		allTimes              map[string][]time.Time
-		expectedTimes         map[string]time.Time
-		expectedNextStartTime time.Time
+		allTimes      map[string][]time.Time
+		expectedTimes map[string]time.Time
 	}
 	for _, td := range []testdata{
 		{
@@ -127,18 +130,15 @@ func TestBetterTimes(t *testing.T) {
 				"3": time.Date(2018, 9, 29, 16, 27, 51, 0, time.UTC),
 				"4": time.Date(2018, 9, 29, 16, 28, 3, 0, time.UTC),
 			},
-			expectedNextStartTime: time.Date(2018, 9, 29, 16, 27, 42, 0, time.UTC),
 		},
 	} {
-		times, nextStartTime := betterTimes(td.allTimes)
+		times := betterTimes(td.allTimes)
 		assert.Equal(t, td.expectedTimes, times)
-		assert.Equal(t, td.expectedNextStartTime, nextStartTime)
 	}
 }
 
 func TestScraperDisableEnhancedMetrics(t *testing.T) {
-	cfg, err := config.Load("../config.tests.yml")
-	require.NoError(t, err)
+	cfg := fakeaws.New(t).LoadConfig(t, "../config.tests.yml")
 	client := client.New()
 	for i := range cfg.Instances {
 		// Disable enhanced metrics in even instances.
@@ -162,12 +162,15 @@ func TestScraperDisableEnhancedMetrics(t *testing.T) {
 	for session, instances := range sess.AllSessions() {
 		session, instances := session, instances
 		t.Run(fmt.Sprint(instances), func(t *testing.T) {
-			s := newScraper(session, instances)
+			s := newScraper(session, instances, health.NewTracker("enhanced"))
 			s.testDisallowUnknownFields = true
-			metrics, _ := s.scrape(context.Background())
+			samples := s.scrape(context.Background())
 
 			for _, instance := range instances {
-				actualMetrics := helpers.ReadMetrics(metrics[instance.ResourceID])
+				var actualMetrics []*helpers.Metric
+				if sample := samples[instance.ResourceID]; sample != nil {
+					actualMetrics = helpers.ReadMetrics(sample.metrics)
+				}
 				actualLines := helpers.Format(helpers.WriteMetrics(actualMetrics))
 				name := instance.Instance
 				if instance.DisableEnhancedMetrics {
@@ -0,0 +1,233 @@
+package enhanced
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// windowsMetrics represents available Enhanced Monitoring OS metrics of RDS for SQL Server instances.
+//
+// See https://docs.aws.amazon.com/AmazonRDS/latest/UserGuide/USER_Monitoring-Available-OS-Metrics.html#USER_Monitoring-Available-OS-Metrics-RDS
+//
+//nolint:lll
+type windowsMetrics struct {
+	Engine             string    `json:"engine"             help:"The database engine for the DB instance."`
+	InstanceID         string    `json:"instanceID"         help:"The DB instance identifier."`
+	InstanceResourceID string    `json:"instanceResourceID" help:"A region-unique, immutable identifier for the DB instance, also used as the log stream identifier."`
+	NumVCPUs           int       `json:"numVCPUs"           help:"The number of virtual CPUs for the DB instance."`
+	Timestamp          time.Time `json:"timestamp"          help:"The time at which the metrics were taken."`
+	Uptime             string    `json:"uptime"             help:"The amount of time that the DB instance has been active."`
+	Version            float64   `json:"version"            help:"The version of the OS metrics' stream JSON format."`
+
+	CPUUtilization windowsCPUUtilization `json:"cpuUtilization"`
+	Disks          []windowsDisk         `json:"disks"`
+	Memory         windowsMemory         `json:"memory"`
+	Network        []windowsNetwork      `json:"network"`
+	ProcessList    []windowsProcess      `json:"processList"`
+	System         windowsSystem         `json:"system"`
+}
+
+type windowsCPUUtilization struct {
+	Idle float64 `json:"idle" help:"The percentage of CPU that is idle."`
+	Kern float64 `json:"kern" help:"The percentage of CPU in use by the kernel."`
+	User float64 `json:"user" help:"The percentage of CPU in use by user programs."`
+}
+
+//nolint:lll
+type windowsDisk struct {
+	Name      string  `json:"name"      help:"The identifier for the disk."`
+	TotalKb   int     `json:"totalKb"   help:"The total size of the disk, in kilobytes."`
+	UsedKb    int     `json:"usedKb"    help:"The amount of space used on the disk, in kilobytes."`
+	UsedPc    float64 `json:"usedPc"    help:"The percentage of space used on the disk."`
+	AvailKb   int     `json:"availKb"   help:"The space available on the disk, in kilobytes."`
+	AvailPc   float64 `json:"availPc"   help:"The percentage of space available on the disk."`
+	RdCountPS float64 `json:"rdCountPS" help:"The number of read operations per second."`
+	RdBytesPS float64 `json:"rdBytesPS" help:"The number of bytes read per second."`
+	WrCountPS float64 `json:"wrCountPS" help:"The number of write operations per second."`
+	WrBytesPS float64 `json:"wrBytesPS" help:"The number of bytes written per second."`
+}
+
+//nolint:lll
+type windowsMemory struct {
+	CommitTotKb    int `json:"commitTotKb"    help:"The amount of pagefile-backed virtual address space in use, that is, the current commit charge, in kilobytes."`
+	CommitLimitKb  int `json:"commitLimitKb"  help:"The maximum possible value for the commitTotKb metric, in kilobytes."`
+	CommitPeakKb   int `json:"commitPeakKb"   help:"The largest value of the commitTotKb metric since the operating system was last started, in kilobytes."`
+	KernTotKb      int `json:"kernTotKb"      help:"The sum of the memory in the paged and nonpaged kernel pools, in kilobytes."`
+	KernPagedKb    int `json:"kernPagedKb"    help:"The amount of memory in the paged kernel pool, in kilobytes."`
+	KernNonpagedKb int `json:"kernNonpagedKb" help:"The amount of memory in the nonpaged kernel pool, in kilobytes."`
+	PageSize       int `json:"pageSize"       help:"The size of a page, in bytes."`
+	PhysTotKb      int `json:"physTotKb"      help:"The amount of physical memory, in kilobytes."`
+	PhysAvailKb    int `json:"physAvailKb"    help:"The amount of available physical memory, in kilobytes."`
+	SQLServerTotKb int `json:"sqlServerTotKb" help:"The amount of memory committed to Microsoft SQL Server, in kilobytes."`
+	SysCacheKb     int `json:"sysCacheKb"     help:"The amount of system cache memory, in kilobytes."`
+}
+
+type windowsNetwork struct {
+	Interface string  `json:"interface" help:"The identifier for the network interface being used for the DB instance."`
+	RdBytesPS float64 `json:"rdBytesPS" help:"The number of bytes received per second."`
+	WrBytesPS float64 `json:"wrBytesPS" help:"The number of bytes sent per second."`
+}
+
+//nolint:lll
+type windowsProcess struct {
+	Name                  string  `json:"name"                  help:"The name of the process."`
+	CPUUsedPC             float64 `json:"cpuUsedPc"             help:"The percentage of CPU used by the process."`
+	MemUsedPC             float64 `json:"memUsedPc"             help:"The percentage of memory used by the process."`
+	PID                   int     `json:"pid"                   help:"The identifier of the process."`
+	ParentPID             int     `json:"parentPid"             help:"The process identifier for the parent of this process."`
+	TID                   int     `json:"tid"                   help:"The thread identifier."`
+	VirtKb                int     `json:"virtKb"                help:"The amount of virtual address space the process is using, in kilobytes."`
+	WorkingSetKb          int     `json:"workingSetKb"          help:"The amount of memory in the private working set plus the amount of memory that is in use by the process and can be shared with other processes, in kilobytes."`
+	WorkingSetPrivKb      int     `json:"workingSetPrivKb"      help:"The amount of memory that is in use by a process, but can't be shared with other processes, in kilobytes."`
+	WorkingSetShareableKb int     `json:"workingSetShareableKb" help:"The amount of memory that is in use by a process and can be shared with other processes, in kilobytes."`
+}
+
+type windowsSystem struct {
+	Handles   int `json:"handles"   help:"The number of handles that the system is using."`
+	Processes int `json:"processes" help:"The number of processes running on the system."`
+	Threads   int `json:"threads"   help:"The number of threads running on the system."`
+}
+
+// isWindowsEngine returns true if given engine publishes Windows Enhanced Monitoring metrics.
+func isWindowsEngine(engine string) bool {
+	return strings.HasPrefix(strings.ToLower(engine), "sqlserver")
+}
+
+// osMetrics returns osMetrics with common fields set.
+func (w *windowsMetrics) osMetrics() *osMetrics {
+	return &osMetrics{
+		Engine:             w.Engine,
+		InstanceID:         w.InstanceID,
+		InstanceResourceID: w.InstanceResourceID,
+		NumVCPUs:           w.NumVCPUs,
+		Timestamp:          w.Timestamp,
+		Uptime:             w.Uptime,
+		Version:            w.Version,
+		windows:            w,
+	}
+}
+
+// makeLabeledMetrics makes metrics for all numeric structure fields, with given labels.
+func makeLabeledMetrics(s interface{}, namePrefix string, labelKeys, labelValues []string, constLabels prometheus.Labels) []prometheus.Metric {
+	t := reflect.TypeOf(s)
+	v := reflect.ValueOf(s)
+	res := make([]prometheus.Metric, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if v.Field(i).Kind() == reflect.String {
+			continue
+		}
+		tags := t.Field(i).Tag
+		name, help := tags.Get("json"), tags.Get("help")
+		desc := newDesc(namePrefix+name, help, labelKeys, constLabels)
+		m := makeGauge(desc, labelValues, v.Field(i))
+		if m != nil {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+// makePrometheusMetrics returns rdsosmetrics_ and windows_exporter-like windows_ metrics.
+//
+//nolint:lll
+func (w *windowsMetrics) makePrometheusMetrics(constLabels prometheus.Labels, options ProcessListOptions) []prometheus.Metric {
+	res := make([]prometheus.Metric, 0, 100)
+
+	res = append(res, makeGenericMetrics(w.CPUUtilization, "rdsosmetrics_cpuUtilization_", constLabels)...)
+	res = append(res, makeGenericMetrics(w.Memory, "rdsosmetrics_memory_", constLabels)...)
+	res = append(res, makeGenericMetrics(w.System, "rdsosmetrics_system_", constLabels)...)
+
+	for _, disk := range w.Disks {
+		res = append(res, makeLabeledMetrics(disk, "rdsosmetrics_disks_", []string{"name"}, []string{disk.Name}, constLabels)...)
+	}
+	for _, n := range w.Network {
+		res = append(res, makeLabeledMetrics(n, "rdsosmetrics_network_", []string{"interface"}, []string{n.Interface}, constLabels)...)
+	}
+
+	// map processes to Linux ones to support process list options
+	processes := make([]processList, len(w.ProcessList))
+	for i, p := range w.ProcessList {
+		processes[i] = processList{
+			CPUUsedPC:    p.CPUUsedPC,
+			ID:           p.PID,
+			MemoryUsedPC: p.MemUsedPC,
+			Name:         p.Name,
+			ParentID:     p.ParentPID,
+			RSS:          p.WorkingSetKb,
+			TGID:         p.TID,
+			VSS:          p.VirtKb,
+		}
+	}
+	res = append(res, makeProcessListMetrics(processes, options, constLabels)...)
+
+	// windows_exporter-like metrics
+	gauge := func(name, help string, value float64) {
+		desc := newDesc(name, help, nil, constLabels)
+		res = append(res, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value))
+	}
+	gauge("windows_cs_logical_processors", "ComputerSystem.NumberOfLogicalProcessors", float64(w.NumVCPUs))
+	gauge("windows_cs_physical_memory_bytes", "ComputerSystem.TotalPhysicalMemory", float64(w.Memory.PhysTotKb)*1024)
+	gauge("windows_os_physical_memory_free_bytes", "OperatingSystem.FreePhysicalMemory", float64(w.Memory.PhysAvailKb)*1024)
+	gauge("windows_os_processes", "OperatingSystem.NumberOfProcesses", float64(w.System.Processes))
+	gauge("windows_memory_committed_bytes", "(Memory.CommittedBytes)", float64(w.Memory.CommitTotKb)*1024)
+	gauge("windows_memory_commit_limit", "(Memory.CommitLimit)", float64(w.Memory.CommitLimitKb)*1024)
+	gauge("windows_memory_pool_paged_bytes", "(Memory.PoolPagedBytes)", float64(w.Memory.KernPagedKb)*1024)
+	gauge("windows_memory_pool_nonpaged_bytes_total", "(Memory.PoolNonpagedBytes)", float64(w.Memory.KernNonpagedKb)*1024)
+	gauge("windows_memory_system_cache_resident_bytes", "(Memory.SystemCacheResidentBytes)", float64(w.Memory.SysCacheKb)*1024)
+	gauge("windows_system_threads", "Current number of threads (WMI source: PerfOS_System.Threads)", float64(w.System.Threads))
+
+	sizeDesc := newDesc("windows_logical_disk_size_bytes", "Total space in bytes (LogicalDisk.PercentFreeSpace_Base)", []string{"volume"}, constLabels)
+	freeDesc := newDesc("windows_logical_disk_free_bytes", "Free space in bytes (LogicalDisk.PercentFreeSpace)", []string{"volume"}, constLabels)
+	for _, disk := range w.Disks {
+		res = append(res, prometheus.MustNewConstMetric(sizeDesc, prometheus.GaugeValue, float64(disk.TotalKb)*1024, disk.Name))
+		res = append(res, prometheus.MustNewConstMetric(freeDesc, prometheus.GaugeValue, float64(disk.AvailKb)*1024, disk.Name))
+	}
+
+	return res
+}
+
+// makeCounterRates returns per-second rates of windows_exporter-like counters.
+//
+//nolint:lll
+func (w *windowsMetrics) makeCounterRates(constLabels prometheus.Labels) []counterRate {
+	res := make([]counterRate, 0, 16)
+
+	// CPU percentages are converted to seconds of all virtual CPUs
+	cpuLabels := make(prometheus.Labels, len(constLabels)+1)
+	for k, v := range constLabels {
+		cpuLabels[k] = v
+	}
+	cpuLabels["core"] = "All"
+	cpuDesc := newDesc("windows_cpu_time_total", "Time that processor spent in different modes (idle, user, system, ...)", []string{"mode"}, cpuLabels)
+	cpu := w.CPUUtilization
+	for mode, value := range map[string]float64{
+		"idle":       cpu.Idle,
+		"privileged": cpu.Kern,
+		"user":       cpu.User,
+	} {
+		res = append(res, counterRate{cpuDesc, []string{mode}, value / 100 * float64(w.NumVCPUs)})
+	}
+
+	readsDesc := newDesc("windows_logical_disk_reads_total", "The number of read operations on the disk (LogicalDisk.DiskReadsPerSec)", []string{"volume"}, constLabels)
+	writesDesc := newDesc("windows_logical_disk_writes_total", "The number of write operations on the disk (LogicalDisk.DiskWritesPerSec)", []string{"volume"}, constLabels)
+	readBytesDesc := newDesc("windows_logical_disk_read_bytes_total", "The number of bytes transferred from the disk during read operations (LogicalDisk.DiskReadBytesPerSec)", []string{"volume"}, constLabels)
+	writeBytesDesc := newDesc("windows_logical_disk_write_bytes_total", "The number of bytes transferred to the disk during write operations (LogicalDisk.DiskWriteBytesPerSec)", []string{"volume"}, constLabels)
+	for _, disk := range w.Disks {
+		res = append(res, counterRate{readsDesc, []string{disk.Name}, disk.RdCountPS})
+		res = append(res, counterRate{writesDesc, []string{disk.Name}, disk.WrCountPS})
+		res = append(res, counterRate{readBytesDesc, []string{disk.Name}, disk.RdBytesPS})
+		res = append(res, counterRate{writeBytesDesc, []string{disk.Name}, disk.WrBytesPS})
+	}
+
+	rxDesc := newDesc("windows_net_bytes_received_total", "(Network.BytesReceivedPerSec)", []string{"nic"}, constLabels)
+	txDesc := newDesc("windows_net_bytes_sent_total", "(Network.BytesSentPerSec)", []string{"nic"}, constLabels)
+	for _, n := range w.Network {
+		res = append(res, counterRate{rxDesc, []string{n.Interface}, n.RdBytesPS})
+		res = append(res, counterRate{txDesc, []string{n.Interface}, n.WrBytesPS})
+	}
+
+	return res
+}
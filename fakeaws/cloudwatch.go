@@ -0,0 +1,147 @@
+package fakeaws
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// metricValue returns value of CloudWatch metric for instance or cluster specified by dimensions, if any.
+func (s *Server) metricValue(region, metric string, dimensions map[string]string) (float64, bool) {
+	if id, ok := dimensions["DBClusterIdentifier"]; ok {
+		cluster := s.cluster(region, id)
+		if cluster == nil {
+			return 0, false
+		}
+		v, ok := cluster.Metrics[metric]
+		return v, ok
+	}
+
+	instance := s.instance(region, dimensions["DBInstanceIdentifier"])
+	if instance == nil {
+		return 0, false
+	}
+	v, ok := instance.Metrics[metric]
+	return v, ok
+}
+
+// parseDimensions parses dimensions list parameters with given prefix.
+func parseDimensions(form url.Values, prefix string) map[string]string {
+	res := make(map[string]string)
+	for i := 1; ; i++ {
+		p := fmt.Sprintf("%sDimensions.member.%d.", prefix, i)
+		name := form.Get(p + "Name")
+		if name == "" {
+			return res
+		}
+		res[name] = form.Get(p + "Value")
+	}
+}
+
+// parseTime parses timestamp parameter, returning current time on error.
+func parseTime(form url.Values, name string) time.Time {
+	t, err := time.Parse(time.RFC3339, form.Get(name))
+	if err != nil {
+		return time.Now()
+	}
+	return t
+}
+
+// getMetricData handles CloudWatch GetMetricData action.
+// It returns a single datapoint at the end of the requested range for each known metric.
+func (s *Server) getMetricData(rw http.ResponseWriter, req *http.Request, region string) {
+	type result struct {
+		ID         string      `xml:"Id"`
+		Label      string      `xml:"Label"`
+		StatusCode string      `xml:"StatusCode"`
+		Timestamps []time.Time `xml:"Timestamps>member"`
+		Values     []float64   `xml:"Values>member"`
+	}
+	type response struct {
+		XMLName xml.Name `xml:"GetMetricDataResponse"`
+		Results []result `xml:"GetMetricDataResult>MetricDataResults>member"`
+	}
+
+	end := parseTime(req.Form, "EndTime").UTC()
+	res := &response{
+		Results: []result{},
+	}
+	for i := 1; ; i++ {
+		p := fmt.Sprintf("MetricDataQueries.member.%d.", i)
+		id := req.Form.Get(p + "Id")
+		if id == "" {
+			break
+		}
+
+		metric := req.Form.Get(p + "MetricStat.Metric.MetricName")
+		r := result{
+			ID:         id,
+			Label:      metric,
+			StatusCode: "Complete",
+			Timestamps: []time.Time{},
+			Values:     []float64{},
+		}
+		period, _ := strconv.Atoi(req.Form.Get(p + "MetricStat.Period"))
+		if v, ok := s.metricValue(region, metric, parseDimensions(req.Form, p+"MetricStat.Metric.")); ok {
+			r.Timestamps = append(r.Timestamps, end.Add(-time.Duration(period)*time.Second))
+			r.Values = append(r.Values, v)
+		}
+		res.Results = append(res.Results, r)
+	}
+
+	writeXML(rw, res)
+}
+
+// getMetricStatistics handles CloudWatch GetMetricStatistics action.
+// It returns a single datapoint at the end of the requested range with all requested statistics set to the same value.
+func (s *Server) getMetricStatistics(rw http.ResponseWriter, req *http.Request, region string) {
+	type datapoint struct {
+		Timestamp   time.Time
+		Average     *float64 `xml:",omitempty"`
+		Maximum     *float64 `xml:",omitempty"`
+		Minimum     *float64 `xml:",omitempty"`
+		Sum         *float64 `xml:",omitempty"`
+		SampleCount *float64 `xml:",omitempty"`
+	}
+	type response struct {
+		XMLName    xml.Name    `xml:"GetMetricStatisticsResponse"`
+		Label      string      `xml:"GetMetricStatisticsResult>Label"`
+		Datapoints []datapoint `xml:"GetMetricStatisticsResult>Datapoints>member"`
+	}
+
+	metric := req.Form.Get("MetricName")
+	res := &response{
+		Label:      metric,
+		Datapoints: []datapoint{},
+	}
+	if v, ok := s.metricValue(region, metric, parseDimensions(req.Form, "")); ok {
+		period, _ := strconv.Atoi(req.Form.Get("Period"))
+		dp := datapoint{
+			Timestamp: parseTime(req.Form, "EndTime").UTC().Add(-time.Duration(period) * time.Second),
+		}
+		for i := 1; ; i++ {
+			stat := req.Form.Get(fmt.Sprintf("Statistics.member.%d", i))
+			if stat == "" {
+				break
+			}
+			switch stat {
+			case "Average":
+				dp.Average = &v
+			case "Maximum":
+				dp.Maximum = &v
+			case "Minimum":
+				dp.Minimum = &v
+			case "Sum":
+				dp.Sum = &v
+			case "SampleCount":
+				dp.SampleCount = &v
+			}
+		}
+		res.Datapoints = append(res.Datapoints, dp)
+	}
+
+	writeXML(rw, res)
+}
@@ -0,0 +1,83 @@
+package fakeaws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// filterLogEvents handles CloudWatch Logs FilterLogEvents action.
+// It returns RDSOSMetrics events (one by default, see SetLogEvents) for each requested known log stream;
+// the latest event has the current timestamp (minus delay set by SetLogDelay).
+func (s *Server) filterLogEvents(rw http.ResponseWriter, req *http.Request, region string) {
+	type request struct {
+		LogGroupName   string   `json:"logGroupName"`
+		LogStreamNames []string `json:"logStreamNames"`
+		StartTime      int64    `json:"startTime"`
+	}
+	type event struct {
+		EventID       string `json:"eventId"`
+		IngestionTime int64  `json:"ingestionTime"`
+		LogStreamName string `json:"logStreamName"`
+		Message       string `json:"message"`
+		Timestamp     int64  `json:"timestamp"`
+	}
+	type response struct {
+		Events []event `json:"events"`
+	}
+
+	var r request
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+		writeJSONError(rw, "InvalidParameterException", err.Error())
+		return
+	}
+	if r.LogGroupName != "RDSOSMetrics" {
+		writeJSONError(rw, "ResourceNotFoundException", "The specified log group does not exist.")
+		return
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	s.rw.RLock()
+	latest := now - int64(s.logDelay/time.Millisecond)
+	n := s.logEvents
+	s.rw.RUnlock()
+	res := &response{
+		Events: []event{},
+	}
+	for _, name := range r.LogStreamNames {
+		for _, instance := range s.instances {
+			if instance.Region != region || instance.ResourceID != name {
+				continue
+			}
+
+			interval := instance.MonitoringInterval * 1000
+			for i := n - 1; i >= 0; i-- {
+				timestamp := latest - int64(i)*interval
+				if timestamp < r.StartTime {
+					continue
+				}
+				res.Events = append(res.Events, event{
+					EventID:       fmt.Sprintf("%s-%d", name, timestamp),
+					IngestionTime: now,
+					LogStreamName: name,
+					Message:       instance.message,
+					Timestamp:     timestamp,
+				})
+			}
+		}
+	}
+
+	rw.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	_ = json.NewEncoder(rw).Encode(res)
+}
+
+// writeJSONError writes JSON protocol error response.
+func writeJSONError(rw http.ResponseWriter, code, message string) {
+	rw.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	rw.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(rw).Encode(map[string]string{
+		"__type":  code,
+		"message": message,
+	})
+}
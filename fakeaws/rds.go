@@ -0,0 +1,138 @@
+package fakeaws
+
+import (
+	"encoding/xml"
+	"net/http"
+	"sort"
+)
+
+type dbInstance struct {
+	DBInstanceIdentifier  string
+	DbiResourceId         string //nolint:golint,stylecheck
+	Engine                string
+	MonitoringInterval    int64
+	EngineVersion         string
+	DBInstanceClass       string
+	AvailabilityZone      string
+	MultiAZ               bool
+	StorageType           string
+	ParameterGroups       []string `xml:"DBParameterGroups>DBParameterGroup>DBParameterGroupName"`
+	AllocatedStorage      int64
+	MaxAllocatedStorage   int64 `xml:",omitempty"`
+	Iops                  int64 `xml:",omitempty"`
+	StorageThroughput     int64 `xml:",omitempty"`
+	BackupRetentionPeriod int64
+	Tags                  []tag `xml:"TagList>Tag"`
+}
+
+type tag struct {
+	Key   string
+	Value string
+}
+
+// describeDBInstances handles RDS DescribeDBInstances action.
+func (s *Server) describeDBInstances(rw http.ResponseWriter, req *http.Request, region string) {
+	type response struct {
+		XMLName   xml.Name     `xml:"DescribeDBInstancesResponse"`
+		Instances []dbInstance `xml:"DescribeDBInstancesResult>DBInstances>DBInstance"`
+	}
+
+	filter := req.Form.Get("DBInstanceIdentifier")
+	res := &response{
+		Instances: []dbInstance{},
+	}
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	for _, instance := range s.instances {
+		if instance.Region != region {
+			continue
+		}
+		if filter != "" && filter != instance.Instance {
+			continue
+		}
+
+		tags := make([]tag, 0, len(instance.Tags))
+		for k, v := range instance.Tags {
+			tags = append(tags, tag{Key: k, Value: v})
+		}
+		sort.Slice(tags, func(i, j int) bool { return tags[i].Key < tags[j].Key })
+
+		res.Instances = append(res.Instances, dbInstance{
+			DBInstanceIdentifier:  instance.Instance,
+			DbiResourceId:         instance.ResourceID,
+			Engine:                instance.Engine,
+			MonitoringInterval:    instance.MonitoringInterval,
+			EngineVersion:         instance.EngineVersion,
+			DBInstanceClass:       instance.InstanceClass,
+			AvailabilityZone:      instance.AvailabilityZone,
+			MultiAZ:               instance.MultiAZ,
+			StorageType:           instance.StorageType,
+			ParameterGroups:       []string{instance.ParameterGroup},
+			AllocatedStorage:      instance.AllocatedStorage,
+			MaxAllocatedStorage:   instance.MaxAllocatedStorage,
+			Iops:                  instance.IOPS,
+			StorageThroughput:     instance.StorageThroughput,
+			BackupRetentionPeriod: instance.BackupRetentionPeriod,
+			Tags:                  tags,
+		})
+	}
+
+	if filter != "" && len(res.Instances) == 0 {
+		writeError(rw, "DBInstanceNotFound", "DBInstance "+filter+" not found.")
+		return
+	}
+	writeXML(rw, res)
+}
+
+type dbClusterMember struct {
+	DBInstanceIdentifier string
+	IsClusterWriter      bool
+}
+
+type dbCluster struct {
+	DBClusterIdentifier string
+	DbClusterResourceId string //nolint:golint,stylecheck
+	Engine              string
+	DBClusterMembers    []dbClusterMember `xml:"DBClusterMembers>DBClusterMember"`
+}
+
+// describeDBClusters handles RDS DescribeDBClusters action.
+func (s *Server) describeDBClusters(rw http.ResponseWriter, req *http.Request, region string) {
+	type response struct {
+		XMLName  xml.Name    `xml:"DescribeDBClustersResponse"`
+		Clusters []dbCluster `xml:"DescribeDBClustersResult>DBClusters>DBCluster"`
+	}
+
+	filter := req.Form.Get("DBClusterIdentifier")
+	res := &response{
+		Clusters: []dbCluster{},
+	}
+	for _, cluster := range s.clusters {
+		if cluster.Region != region {
+			continue
+		}
+		if filter != "" && filter != cluster.Cluster {
+			continue
+		}
+
+		c := dbCluster{
+			DBClusterIdentifier: cluster.Cluster,
+			DbClusterResourceId: cluster.ResourceID,
+			Engine:              cluster.Engine,
+			DBClusterMembers:    []dbClusterMember{},
+		}
+		for _, member := range cluster.Members {
+			c.DBClusterMembers = append(c.DBClusterMembers, dbClusterMember{
+				DBInstanceIdentifier: member.Instance,
+				IsClusterWriter:      member.Writer,
+			})
+		}
+		res.Clusters = append(res.Clusters, c)
+	}
+
+	if filter != "" && len(res.Clusters) == 0 {
+		writeError(rw, "DBClusterNotFoundFault", "DBCluster "+filter+" not found.")
+		return
+	}
+	writeXML(rw, res)
+}
@@ -0,0 +1,120 @@
+package fakeaws
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// assumeRole handles STS AssumeRole action.
+func (s *Server) assumeRole(rw http.ResponseWriter, req *http.Request) {
+	type response struct {
+		XMLName         xml.Name  `xml:"AssumeRoleResponse"`
+		AccessKeyID     string    `xml:"AssumeRoleResult>Credentials>AccessKeyId"`
+		SecretAccessKey string    `xml:"AssumeRoleResult>Credentials>SecretAccessKey"`
+		SessionToken    string    `xml:"AssumeRoleResult>Credentials>SessionToken"`
+		Expiration      time.Time `xml:"AssumeRoleResult>Credentials>Expiration"`
+		Arn             string    `xml:"AssumeRoleResult>AssumedRoleUser>Arn"`
+		AssumedRoleID   string    `xml:"AssumeRoleResult>AssumedRoleUser>AssumedRoleId"`
+	}
+
+	roleArn := req.Form.Get("RoleArn")
+	if roleArn == "" {
+		writeError(rw, "ValidationError", "RoleArn is required.")
+		return
+	}
+
+	writeXML(rw, &response{
+		AccessKeyID:     s.roleKey(roleArn, req.Form.Get("RoleSessionName")),
+		SecretAccessKey: "fake",
+		SessionToken:    "fake",
+		Expiration:      time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+		Arn:             roleArn + "/" + req.Form.Get("RoleSessionName"),
+		AssumedRoleID:   "AROAFAKEFAKEFAKEFAKE:" + req.Form.Get("RoleSessionName"),
+	})
+}
+
+// assumeRoleWithWebIdentity handles STS AssumeRoleWithWebIdentity action.
+func (s *Server) assumeRoleWithWebIdentity(rw http.ResponseWriter, req *http.Request) {
+	type response struct {
+		XMLName         xml.Name  `xml:"AssumeRoleWithWebIdentityResponse"`
+		AccessKeyID     string    `xml:"AssumeRoleWithWebIdentityResult>Credentials>AccessKeyId"`
+		SecretAccessKey string    `xml:"AssumeRoleWithWebIdentityResult>Credentials>SecretAccessKey"`
+		SessionToken    string    `xml:"AssumeRoleWithWebIdentityResult>Credentials>SessionToken"`
+		Expiration      time.Time `xml:"AssumeRoleWithWebIdentityResult>Credentials>Expiration"`
+		Arn             string    `xml:"AssumeRoleWithWebIdentityResult>AssumedRoleUser>Arn"`
+		AssumedRoleID   string    `xml:"AssumeRoleWithWebIdentityResult>AssumedRoleUser>AssumedRoleId"`
+	}
+
+	roleArn := req.Form.Get("RoleArn")
+	if roleArn == "" {
+		writeError(rw, "ValidationError", "RoleArn is required.")
+		return
+	}
+	if req.Form.Get("WebIdentityToken") == "" {
+		writeError(rw, "InvalidIdentityToken", "WebIdentityToken is required.")
+		return
+	}
+
+	writeXML(rw, &response{
+		AccessKeyID:     s.roleKey(roleArn, req.Form.Get("RoleSessionName")),
+		SecretAccessKey: "fake",
+		SessionToken:    "fake",
+		Expiration:      time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+		Arn:             roleArn + "/" + req.Form.Get("RoleSessionName"),
+		AssumedRoleID:   "AROAFAKEFAKEFAKEFAKE:" + req.Form.Get("RoleSessionName"),
+	})
+}
+
+// roleKey returns a new access key for assumed role, and remembers its identity for GetCallerIdentity.
+func (s *Server) roleKey(roleArn, sessionName string) string {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	key := fmt.Sprintf("ASIAFAKE%012d", len(s.roles))
+	account, name := defaultAccount, roleArn
+	if parts := strings.SplitN(roleArn, ":", 6); len(parts) == 6 {
+		account, name = parts[4], strings.TrimPrefix(parts[5], "role/")
+	}
+	s.roles[key] = callerIdentity{
+		Account: account,
+		Arn:     fmt.Sprintf("arn:aws:sts::%s:assumed-role/%s/%s", account, name, sessionName),
+	}
+	return key
+}
+
+// defaultAccount is returned by GetCallerIdentity for credentials that are not assumed roles.
+const defaultAccount = "123456789012"
+
+type callerIdentity struct {
+	Account string
+	Arn     string
+}
+
+// getCallerIdentity handles STS GetCallerIdentity action.
+func (s *Server) getCallerIdentity(rw http.ResponseWriter, accessKey string) {
+	type response struct {
+		XMLName xml.Name `xml:"GetCallerIdentityResponse"`
+		Account string   `xml:"GetCallerIdentityResult>Account"`
+		Arn     string   `xml:"GetCallerIdentityResult>Arn"`
+		UserID  string   `xml:"GetCallerIdentityResult>UserId"`
+	}
+
+	s.rw.RLock()
+	identity, ok := s.roles[accessKey]
+	s.rw.RUnlock()
+	if !ok {
+		identity = callerIdentity{
+			Account: defaultAccount,
+			Arn:     "arn:aws:iam::" + defaultAccount + ":user/fake",
+		}
+	}
+
+	writeXML(rw, &response{
+		Account: identity.Account,
+		Arn:     identity.Arn,
+		UserID:  accessKey,
+	})
+}
@@ -0,0 +1,156 @@
+// Package health tracks scrape health of RDS instances.
+package health
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/percona/rds_exporter/sessions"
+)
+
+var (
+	upDesc = prometheus.NewDesc(
+		"rds_exporter_instance_up",
+		"Whether the last scrape of the instance was successful.",
+		[]string{"region", "instance", "source"},
+		nil,
+	)
+	lastSuccessDesc = prometheus.NewDesc(
+		"rds_exporter_instance_last_success_timestamp_seconds",
+		"Timestamp of the last successful scrape of the instance.",
+		[]string{"region", "instance", "source"},
+		nil,
+	)
+)
+
+// state represents scrape health of a single instance.
+type state struct {
+	region      string
+	instance    string
+	up          bool
+	lastSuccess time.Time
+}
+
+// Tracker tracks scrape health of instances for a single metrics source (basic or enhanced).
+// It implements prometheus.Collector.
+type Tracker struct {
+	source string
+
+	rw     sync.RWMutex
+	states map[string]*state // region/instance => state
+
+	mErrors *prometheus.CounterVec
+}
+
+// NewTracker creates a new Tracker for given metrics source.
+func NewTracker(source string) *Tracker {
+	return &Tracker{
+		source: source,
+		states: make(map[string]*state),
+		mErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rds_exporter_scrape_errors_total",
+			Help: "Total number of scrape errors by component and AWS error code.",
+		}, []string{"component", "code"}),
+	}
+}
+
+func key(instance sessions.Instance) string {
+	return instance.Region + "/" + instance.Instance
+}
+
+// Success records successful scrape of given instance.
+func (t *Tracker) Success(instance sessions.Instance) {
+	t.rw.Lock()
+	defer t.rw.Unlock()
+
+	s := t.state(instance)
+	s.up = true
+	s.lastSuccess = time.Now()
+}
+
+// Failure records failed scrape of given instance.
+func (t *Tracker) Failure(instance sessions.Instance) {
+	t.rw.Lock()
+	defer t.rw.Unlock()
+
+	s := t.state(instance)
+	s.up = false
+}
+
+// state returns state for given instance, creating it if needed. Lock should be held.
+func (t *Tracker) state(instance sessions.Instance) *state {
+	s := t.states[key(instance)]
+	if s == nil {
+		s = &state{
+			region:   instance.Region,
+			instance: instance.Instance,
+		}
+		t.states[key(instance)] = s
+	}
+	return s
+}
+
+// Error counts given error for given component.
+func (t *Tracker) Error(component string, err error) {
+	t.mErrors.WithLabelValues(component, ErrorCode(err)).Inc()
+}
+
+// Retain forgets all instances except given ones.
+func (t *Tracker) Retain(instances []sessions.Instance) {
+	keep := make(map[string]struct{}, len(instances))
+	for _, instance := range instances {
+		keep[key(instance)] = struct{}{}
+	}
+
+	t.rw.Lock()
+	defer t.rw.Unlock()
+
+	for k := range t.states {
+		if _, ok := keep[k]; !ok {
+			delete(t.states, k)
+		}
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (t *Tracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- upDesc
+	ch <- lastSuccessDesc
+	t.mErrors.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (t *Tracker) Collect(ch chan<- prometheus.Metric) {
+	t.rw.RLock()
+	for _, s := range t.states {
+		var up float64
+		if s.up {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, up, s.region, s.instance, t.source)
+
+		if !s.lastSuccess.IsZero() {
+			v := float64(s.lastSuccess.UnixNano()) / 1e9
+			ch <- prometheus.MustNewConstMetric(lastSuccessDesc, prometheus.GaugeValue, v, s.region, s.instance, t.source)
+		}
+	}
+	t.rw.RUnlock()
+
+	t.mErrors.Collect(ch)
+}
+
+// ErrorCode returns AWS error code for given error, or "unknown" for non-AWS errors.
+func ErrorCode(err error) string {
+	if e, ok := err.(awserr.Error); ok && e.Code() != "" {
+		return e.Code()
+	}
+	return "unknown"
+}
+
+// check interfaces
+var (
+	_ prometheus.Collector = (*Tracker)(nil)
+)
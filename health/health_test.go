@@ -0,0 +1,61 @@
+package health
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/percona/exporter_shared/helpers"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/percona/rds_exporter/sessions"
+)
+
+func TestTracker(t *testing.T) {
+	i1 := sessions.Instance{Region: "us-east-1", Instance: "i1"}
+	i2 := sessions.Instance{Region: "us-east-1", Instance: "i2"}
+	i3 := sessions.Instance{Region: "us-west-2", Instance: "i3"}
+
+	tr := NewTracker("basic")
+	tr.Success(i1)
+	tr.Failure(i2)
+	tr.Success(i3)
+	tr.Failure(i3)
+	tr.Error("basic", awserr.New("Throttling", "Rate exceeded", nil))
+	tr.Error("basic", errors.New("connection reset"))
+
+	metrics := helpers.ReadMetrics(helpers.CollectMetrics(tr))
+	for _, m := range metrics {
+		if m.Name == "rds_exporter_instance_last_success_timestamp_seconds" {
+			m.Value = 0
+		}
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Less(metrics[j]) })
+	expected := []string{
+		`# HELP rds_exporter_instance_last_success_timestamp_seconds Timestamp of the last successful scrape of the instance.`,
+		`# TYPE rds_exporter_instance_last_success_timestamp_seconds gauge`,
+		`rds_exporter_instance_last_success_timestamp_seconds{instance="i1",region="us-east-1",source="basic"} 0`,
+		`rds_exporter_instance_last_success_timestamp_seconds{instance="i3",region="us-west-2",source="basic"} 0`,
+		`# HELP rds_exporter_instance_up Whether the last scrape of the instance was successful.`,
+		`# TYPE rds_exporter_instance_up gauge`,
+		`rds_exporter_instance_up{instance="i1",region="us-east-1",source="basic"} 1`,
+		`rds_exporter_instance_up{instance="i2",region="us-east-1",source="basic"} 0`,
+		`rds_exporter_instance_up{instance="i3",region="us-west-2",source="basic"} 0`,
+		`# HELP rds_exporter_scrape_errors_total Total number of scrape errors by component and AWS error code.`,
+		`# TYPE rds_exporter_scrape_errors_total counter`,
+		`rds_exporter_scrape_errors_total{code="Throttling",component="basic"} 1`,
+		`rds_exporter_scrape_errors_total{code="unknown",component="basic"} 1`,
+	}
+	assert.Equal(t, expected, helpers.Format(helpers.WriteMetrics(metrics)))
+
+	tr.Retain([]sessions.Instance{i2})
+	metrics = helpers.ReadMetrics(helpers.CollectMetrics(tr))
+	var up []string
+	for _, m := range metrics {
+		if m.Name == "rds_exporter_instance_up" {
+			up = append(up, m.Labels["instance"])
+		}
+	}
+	assert.Equal(t, []string{"i2"}, up)
+}
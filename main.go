@@ -1,7 +1,12 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -13,24 +18,61 @@ import (
 	"github.com/percona/rds_exporter/client"
 	"github.com/percona/rds_exporter/config"
 	"github.com/percona/rds_exporter/enhanced"
+	"github.com/percona/rds_exporter/sd"
 	"github.com/percona/rds_exporter/sessions"
 )
 
 //nolint:lll
 var (
-	listenAddressF       = kingpin.Flag("web.listen-address", "Address on which to expose metrics and web interface.").Default(":9042").String()
-	basicMetricsPathF    = kingpin.Flag("web.basic-telemetry-path", "Path under which to expose exporter's basic metrics.").Default("/basic").String()
-	enhancedMetricsPathF = kingpin.Flag("web.enhanced-telemetry-path", "Path under which to expose exporter's enhanced metrics.").Default("/enhanced").String()
-	configFileF          = kingpin.Flag("config.file", "Path to configuration file.").Default("config.yml").String()
-	logTraceF            = kingpin.Flag("log.trace", "Enable verbose tracing of AWS requests (will log credentials).").Default("false").Bool()
+	listenAddressF          = kingpin.Flag("web.listen-address", "Address on which to expose metrics and web interface.").Default(":9042").String()
+	basicMetricsPathF       = kingpin.Flag("web.basic-telemetry-path", "Path under which to expose exporter's basic metrics.").Default("/basic").String()
+	enhancedMetricsPathF    = kingpin.Flag("web.enhanced-telemetry-path", "Path under which to expose exporter's enhanced metrics.").Default("/enhanced").String()
+	probePathF              = kingpin.Flag("web.probe-path", "Path under which to expose metrics of a single instance for multi-target scraping.").Default("/probe").String()
+	sdPathF                 = kingpin.Flag("web.sd-path", "Path under which to expose monitored instances in Prometheus HTTP service discovery format.").Default("/sd").String()
+	firehosePathF           = kingpin.Flag("web.firehose-path", "Path under which to accept Kinesis Data Firehose deliveries of Enhanced Monitoring events (with firehose ingestion).").Default("/firehose").String()
+	configFileF             = kingpin.Flag("config.file", "Path to configuration file.").Default("config.yml").String()
+	refreshIntervalF        = kingpin.Flag("sessions.refresh-interval", "Interval of re-resolving instances' resource IDs and Enhanced Monitoring intervals (0 disables).").Default("5m").Duration()
+	processListModeF        = kingpin.Flag("enhanced.process-list", "Enhanced processList metrics: all, off, top-cpu, top-memory, or name (aggregated by process name).").Default(string(enhanced.ProcessListAll)).Enum(processListModes()...)
+	processListTopF         = kingpin.Flag("enhanced.process-list-top", "Number of processes for top-cpu and top-memory processList modes.").Default(strconv.Itoa(enhanced.DefaultProcessListTopN)).Int()
+	processListPIDLabelsF   = kingpin.Flag("enhanced.process-list-pid-labels", "Add process ID labels to processList metrics; if disabled, processes are identified by name and rank.").Default("true").Bool()
+	enhancedStaleIntervalsF = kingpin.Flag("enhanced.stale-intervals", "Number of Enhanced Monitoring intervals (or poll or Firehose buffering intervals, if longer) after which instance's enhanced metrics are dropped.").Default("3").Int()
+	enhancedTimestampsF     = kingpin.Flag("enhanced.timestamps", "Expose enhanced metrics with their Enhanced Monitoring event timestamps instead of scrape timestamps.").Default("false").Bool()
+	enhancedIngestionF      = kingpin.Flag("enhanced.ingestion", "Enhanced Monitoring events ingestion: poll (CloudWatch Logs FilterLogEvents) or firehose (Kinesis Data Firehose HTTP endpoint deliveries).").Default(string(enhanced.IngestionPoll)).Enum(ingestionModes()...)
+	firehoseAccessKeyF      = kingpin.Flag("enhanced.firehose-access-key", "Access key required in Kinesis Data Firehose deliveries.").Envar("RDS_EXPORTER_FIREHOSE_ACCESS_KEY").String()
+	firehoseBufferIntervalF = kingpin.Flag("enhanced.firehose-buffer-interval", "Buffering interval of Kinesis Data Firehose delivery stream (with firehose ingestion); used to detect stale instances.").Default("60s").Duration()
+	enhancedBufferSizeF     = kingpin.Flag("enhanced.buffer-size", "Number of latest Enhanced Monitoring samples per instance exposed on each scrape with timestamps; 0 exposes only the latest sample.").Default("0").Int()
+	logTraceF               = kingpin.Flag("log.trace", "Enable verbose tracing of AWS requests (will log credentials).").Default("false").Bool()
 )
 
+// processListModes returns valid values of --enhanced.process-list flag.
+func processListModes() []string {
+	res := make([]string, len(enhanced.ProcessListModes))
+	for i, mode := range enhanced.ProcessListModes {
+		res[i] = string(mode)
+	}
+	return res
+}
+
+// ingestionModes returns valid values of --enhanced.ingestion flag.
+func ingestionModes() []string {
+	res := make([]string, len(enhanced.IngestionModes))
+	for i, mode := range enhanced.IngestionModes {
+		res[i] = string(mode)
+	}
+	return res
+}
+
 func main() {
 	log.AddFlags(kingpin.CommandLine)
 	log.Infoln("Starting RDS exporter", version.Info())
 	log.Infoln("Build context", version.BuildContext())
 	kingpin.Parse()
 
+	ingestion := enhanced.IngestionMode(*enhancedIngestionF)
+	if ingestion == enhanced.IngestionFirehose && *firehoseAccessKeyF == "" {
+		log.Fatalf("--enhanced.firehose-access-key is required for firehose ingestion.")
+	}
+
 	cfg, err := config.Load(*configFileF)
 	if err != nil {
 		log.Fatalf("Can't read configuration file: %s", err)
@@ -42,27 +84,78 @@ func main() {
 		log.Fatalf("Can't create sessions: %s", err)
 	}
 
+	basicCollector := basic.New(cfg, sess)
+	enhancedCollector := enhanced.NewCollector(sess, enhanced.Options{
+		StaleIntervals: *enhancedStaleIntervalsF,
+		ProcessList: enhanced.ProcessListOptions{
+			Mode:        enhanced.ProcessListMode(*processListModeF),
+			TopN:        *processListTopF,
+			NoPIDLabels: !*processListPIDLabelsF,
+		},
+		Timestamps:             *enhancedTimestampsF,
+		BufferSize:             *enhancedBufferSizeF,
+		Ingestion:              ingestion,
+		FirehoseBufferInterval: *firehoseBufferIntervalF,
+	})
+
+	// start discovery and periodic refresh only after all collectors subscribed to sessions updates
+	reloader := newReloader(*configFileF, sess, basicCollector, client.HTTP(), *logTraceF)
+	if err = reloader.start(cfg); err != nil {
+		log.Fatalf("Can't create discovery: %s", err)
+	}
+	if *refreshIntervalF > 0 {
+		go sess.Run(context.Background(), *refreshIntervalF)
+	}
+
 	// basic metrics + client metrics + exporter own metrics (ProcessCollector and GoCollector)
 	{
-		prometheus.MustRegister(basic.New(cfg, sess))
+		prometheus.MustRegister(basicCollector)
+		prometheus.MustRegister(sess)
 		prometheus.MustRegister(client)
+		prometheus.MustRegister(reloader)
 		http.Handle(*basicMetricsPathF, promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{
 			ErrorLog:      log.NewErrorLogger(),
 			ErrorHandling: promhttp.ContinueOnError,
 		}))
 	}
 
-	// enhanced metrics
+	// enhanced metrics; collector gathers itself to expose all buffered samples
 	{
-		registry := prometheus.NewRegistry()
-		registry.MustRegister(enhanced.NewCollector(sess))
-		http.Handle(*enhancedMetricsPathF, promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		http.Handle(*enhancedMetricsPathF, promhttp.HandlerFor(enhancedCollector, promhttp.HandlerOpts{
 			ErrorLog:      log.NewErrorLogger(),
 			ErrorHandling: promhttp.ContinueOnError,
 		}))
 	}
 
+	// Enhanced Monitoring events pushed by Kinesis Data Firehose
+	if ingestion == enhanced.IngestionFirehose {
+		http.Handle(*firehosePathF, enhancedCollector.FirehoseHandler(*firehoseAccessKeyF))
+	}
+
+	// multi-target probes
+	http.Handle(*probePathF, &prober{
+		basic:    basicCollector,
+		enhanced: enhancedCollector,
+	})
+
+	// service discovery
+	http.Handle(*sdPathF, sd.NewHandler(sess))
+
+	// configuration reload
+	{
+		http.Handle("/-/reload", reloader)
+
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go reloader.reloadOn(hup)
+	}
+
 	log.Infof("Basic metrics   : http://%s%s", *listenAddressF, *basicMetricsPathF)
 	log.Infof("Enhanced metrics: http://%s%s", *listenAddressF, *enhancedMetricsPathF)
+	log.Infof("Probes          : http://%s%s?target=<region>/<instance>&module=basic|enhanced", *listenAddressF, *probePathF)
+	log.Infof("Discovery       : http://%s%s", *listenAddressF, *sdPathF)
+	if ingestion == enhanced.IngestionFirehose {
+		log.Infof("Firehose        : http://%s%s", *listenAddressF, *firehosePathF)
+	}
 	log.Fatal(http.ListenAndServe(*listenAddressF, nil))
 }
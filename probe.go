@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/log"
+
+	"github.com/percona/rds_exporter/basic"
+	"github.com/percona/rds_exporter/enhanced"
+)
+
+// probeTimeoutOffset is subtracted from Prometheus scrape timeout to leave time for sending response.
+const probeTimeoutOffset = 500 * time.Millisecond
+
+// prober handles multi-target requests like /probe?target=<region>/<instance>&module=basic|enhanced.
+type prober struct {
+	basic    *basic.Collector
+	enhanced *enhanced.Collector
+}
+
+// ServeHTTP implements http.Handler.
+func (p *prober) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	params := req.URL.Query()
+	parts := strings.SplitN(params.Get("target"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(rw, "Target parameter should be in <region>/<instance> format.", http.StatusBadRequest)
+		return
+	}
+	region, instance := parts[0], parts[1]
+
+	ctx := req.Context()
+	if v := req.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); v != "" {
+		seconds, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			http.Error(rw, fmt.Sprintf("Failed to parse timeout from Prometheus header: %s.", err), http.StatusBadRequest)
+			return
+		}
+		timeout := time.Duration(seconds*float64(time.Second)) - probeTimeoutOffset
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+	}
+
+	var collector prometheus.Collector
+	switch module := params.Get("module"); module {
+	case "", "basic":
+		collector = p.basic.InstanceCollector(ctx, region, instance)
+	case "enhanced":
+		collector = p.enhanced.InstanceCollector(region, instance)
+	default:
+		http.Error(rw, fmt.Sprintf("Unknown module %q.", module), http.StatusBadRequest)
+		return
+	}
+	if collector == nil {
+		http.Error(rw, fmt.Sprintf("Unknown target %q.", params.Get("target")), http.StatusNotFound)
+		return
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		ErrorLog:      log.NewErrorLogger(),
+		ErrorHandling: promhttp.HTTPErrorOnError,
+	}).ServeHTTP(rw, req)
+}
+
+// check interfaces
+var (
+	_ http.Handler = (*prober)(nil)
+)
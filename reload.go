@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+
+	"github.com/percona/rds_exporter/basic"
+	"github.com/percona/rds_exporter/config"
+	"github.com/percona/rds_exporter/discovery"
+	"github.com/percona/rds_exporter/sessions"
+)
+
+// reloader re-reads configuration file and applies changes to running exporter.
+type reloader struct {
+	filename string
+	sessions *sessions.Sessions
+	basic    *basic.Collector
+	client   *http.Client
+	trace    bool
+	logger   log.Logger
+
+	m               sync.Mutex
+	cancelDiscovery context.CancelFunc
+	discoveryDone   chan struct{} // closed when running discoverer exits
+
+	mSuccess   prometheus.Gauge
+	mTimestamp prometheus.Gauge
+}
+
+func newReloader(filename string, sessions *sessions.Sessions, basic *basic.Collector, client *http.Client, trace bool) *reloader {
+	return &reloader{
+		filename: filename,
+		sessions: sessions,
+		basic:    basic,
+		client:   client,
+		trace:    trace,
+		logger:   log.With("component", "reloader"),
+
+		mSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "rds_exporter_config_last_reload_successful",
+			Help: "Whether the last configuration reload attempt was successful.",
+		}),
+		mTimestamp: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "rds_exporter_config_last_reload_success_timestamp_seconds",
+			Help: "Timestamp of the last successful configuration reload.",
+		}),
+	}
+}
+
+// start applies initial configuration which was used to create sessions.
+func (r *reloader) start(cfg *config.Config) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	d, err := r.newDiscoverer(cfg.Discovery)
+	if err != nil {
+		return err
+	}
+	r.runDiscoverer(d)
+
+	r.mSuccess.Set(1)
+	r.mTimestamp.SetToCurrentTime()
+	return nil
+}
+
+// reload re-reads configuration file and applies it.
+// Running configuration is not changed if the new one is invalid.
+func (r *reloader) reload() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	err := r.apply()
+	if err != nil {
+		r.mSuccess.Set(0)
+		r.logger.Errorf("Failed to reload configuration: %s.", err)
+		return err
+	}
+
+	r.mSuccess.Set(1)
+	r.mTimestamp.SetToCurrentTime()
+	r.logger.Infof("Configuration reloaded.")
+	return nil
+}
+
+// reloadOn reloads configuration on each received signal until channel is closed.
+func (r *reloader) reloadOn(signals <-chan os.Signal) {
+	for range signals {
+		_ = r.reload()
+	}
+}
+
+func (r *reloader) apply() error {
+	cfg, err := config.Load(r.filename)
+	if err != nil {
+		return err
+	}
+
+	// create discoverer first to validate its configuration
+	d, err := r.newDiscoverer(cfg.Discovery)
+	if err != nil {
+		return err
+	}
+
+	if err = r.sessions.Update(cfg.Instances); err != nil {
+		return err
+	}
+	r.basic.SetConfig(cfg)
+
+	// running discoverer may be in the middle of updating sessions; wait for it
+	// to exit before forgetting instances discovered with the previous configuration
+	r.stopDiscoverer()
+	if d == nil {
+		if err = r.sessions.SetDiscovered(nil); err != nil {
+			return err
+		}
+	}
+	r.runDiscoverer(d)
+	return nil
+}
+
+// newDiscoverer returns a new discoverer for given configuration, or nil if discovery is not configured.
+func (r *reloader) newDiscoverer(cfg *config.Discovery) (*discovery.Discoverer, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	return discovery.New(cfg, r.sessions, r.client, r.trace)
+}
+
+// stopDiscoverer stops running discoverer (if any) and waits for it to exit.
+func (r *reloader) stopDiscoverer() {
+	if r.cancelDiscovery == nil {
+		return
+	}
+
+	r.cancelDiscovery()
+	<-r.discoveryDone
+	r.cancelDiscovery = nil
+	r.discoveryDone = nil
+}
+
+// runDiscoverer stops running discoverer (if any) and starts given one (if not nil).
+func (r *reloader) runDiscoverer(d *discovery.Discoverer) {
+	r.stopDiscoverer()
+	if d == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	r.cancelDiscovery = cancel
+	r.discoveryDone = done
+	go func() {
+		d.Run(ctx)
+		close(done)
+	}()
+}
+
+// ServeHTTP implements http.Handler for reload endpoint.
+func (r *reloader) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		rw.Header().Set("Allow", http.MethodPost)
+		http.Error(rw, "Only POST requests allowed.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.reload(); err != nil {
+		http.Error(rw, fmt.Sprintf("Failed to reload configuration: %s.", err), http.StatusInternalServerError)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+}
+
+// Describe implements prometheus.Collector.
+func (r *reloader) Describe(ch chan<- *prometheus.Desc) {
+	r.mSuccess.Describe(ch)
+	r.mTimestamp.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (r *reloader) Collect(ch chan<- prometheus.Metric) {
+	r.mSuccess.Collect(ch)
+	r.mTimestamp.Collect(ch)
+}
+
+// check interfaces
+var (
+	_ http.Handler         = (*reloader)(nil)
+	_ prometheus.Collector = (*reloader)(nil)
+)
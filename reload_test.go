@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/percona/rds_exporter/basic"
+	"github.com/percona/rds_exporter/client"
+	"github.com/percona/rds_exporter/config"
+	"github.com/percona/rds_exporter/fakeaws"
+	"github.com/percona/rds_exporter/sessions"
+)
+
+// setupReloader returns a started reloader for configuration file with given instances,
+// fake AWS server, and a function for rewriting that file.
+func setupReloader(t *testing.T, instances ...string) (*reloader, *sessions.Sessions, *fakeaws.Server, func(...string)) {
+	t.Helper()
+
+	fake := fakeaws.New(t)
+	dir, err := ioutil.TempDir("", "rds_exporter_reload")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	filename := filepath.Join(dir, "config.yml")
+	write := func(instances ...string) {
+		data := "instances:\n"
+		for _, instance := range instances {
+			data += fmt.Sprintf("  - region: us-east-1\n    instance: %s\n    endpoint: %s\n", instance, fake.URL)
+		}
+		require.NoError(t, ioutil.WriteFile(filename, []byte(data), 0600))
+	}
+	write(instances...)
+
+	cfg, err := config.Load(filename)
+	require.NoError(t, err)
+	client := client.New()
+	sess, err := sessions.New(cfg.Instances, client.HTTP(), false)
+	require.NoError(t, err)
+	r := newReloader(filename, sess, basic.New(cfg, sess), client.HTTP(), false)
+	require.NoError(t, r.start(cfg))
+	return r, sess, fake, write
+}
+
+// writeInvalid writes configuration file that is valid, but can't be applied:
+// it uses a profile with invalid shared configuration.
+func writeInvalid(t *testing.T, r *reloader) {
+	t.Helper()
+
+	dir := filepath.Dir(r.filename)
+	configFile := filepath.Join(dir, "aws_config")
+	data := "[profile broken]\nrole_arn = arn:aws:iam::123456789012:role/rds\ncredential_source = Unknown\n"
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(data), 0600))
+	prev, ok := os.LookupEnv("AWS_CONFIG_FILE")
+	require.NoError(t, os.Setenv("AWS_CONFIG_FILE", configFile))
+	t.Cleanup(func() {
+		if ok {
+			_ = os.Setenv("AWS_CONFIG_FILE", prev)
+		} else {
+			_ = os.Unsetenv("AWS_CONFIG_FILE")
+		}
+	})
+
+	data = "instances:\n  - region: us-east-1\n    instance: autotest-psql-10\n    aws_profile: broken\n"
+	require.NoError(t, ioutil.WriteFile(r.filename, []byte(data), 0600))
+}
+
+// assertInstances checks that sessions contain only given instances of us-east-1 region, even after refresh.
+func assertInstances(t *testing.T, sess *sessions.Sessions, instances ...string) {
+	t.Helper()
+
+	require.NoError(t, sess.Refresh())
+	var actual []string
+	for _, is := range sess.AllSessions() {
+		for _, instance := range is {
+			actual = append(actual, instance.Instance)
+		}
+	}
+	assert.ElementsMatch(t, instances, actual)
+}
+
+func TestReloadSignal(t *testing.T) {
+	r, sess, _, write := setupReloader(t, "autotest-aurora-mysql-56")
+	signals := make(chan os.Signal)
+	done := make(chan struct{})
+	go func() {
+		r.reloadOn(signals)
+		close(done)
+	}()
+	defer func() {
+		close(signals)
+		<-done
+	}()
+
+	// reload is finished when the next signal is received
+	reload := func() {
+		signals <- syscall.SIGHUP
+		signals <- syscall.SIGHUP
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(r.filename, []byte("instances: ["), 0600))
+		reload()
+		assert.Equal(t, 0.0, testutil.ToFloat64(r.mSuccess))
+		assertInstances(t, sess, "autotest-aurora-mysql-56")
+	})
+
+	t.Run("NotApplied", func(t *testing.T) {
+		writeInvalid(t, r)
+		reload()
+		assert.Equal(t, 0.0, testutil.ToFloat64(r.mSuccess))
+		assertInstances(t, sess, "autotest-aurora-mysql-56")
+	})
+
+	t.Run("Valid", func(t *testing.T) {
+		write("autotest-psql-10")
+		reload()
+		assert.Equal(t, 1.0, testutil.ToFloat64(r.mSuccess))
+		assertInstances(t, sess, "autotest-psql-10")
+	})
+}
+
+func TestReloadHTTP(t *testing.T) {
+	r, sess, _, write := setupReloader(t, "autotest-aurora-mysql-56")
+	post := func(method string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, "/-/reload", nil))
+		return rec
+	}
+
+	t.Run("Method", func(t *testing.T) {
+		rec := post(http.MethodGet)
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+		assert.Equal(t, http.MethodPost, rec.Header().Get("Allow"))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(r.filename, []byte("instances: ["), 0600))
+		rec := post(http.MethodPost)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.True(t, strings.HasPrefix(rec.Body.String(), "Failed to reload configuration: "), "%s", rec.Body.String())
+		assert.Equal(t, 0.0, testutil.ToFloat64(r.mSuccess))
+		assertInstances(t, sess, "autotest-aurora-mysql-56")
+	})
+
+	t.Run("NotApplied", func(t *testing.T) {
+		writeInvalid(t, r)
+		rec := post(http.MethodPost)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Equal(t, 0.0, testutil.ToFloat64(r.mSuccess))
+		assertInstances(t, sess, "autotest-aurora-mysql-56")
+	})
+
+	t.Run("Valid", func(t *testing.T) {
+		before := time.Now().Unix()
+		write("autotest-psql-10")
+		rec := post(http.MethodPost)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, 1.0, testutil.ToFloat64(r.mSuccess))
+		assert.GreaterOrEqual(t, testutil.ToFloat64(r.mTimestamp), float64(before))
+		assertInstances(t, sess, "autotest-psql-10")
+	})
+}
+
+func TestReloadRemoveDiscovery(t *testing.T) {
+	r, sess, fake, write := setupReloader(t, "autotest-aurora-mysql-56")
+	data := fmt.Sprintf("instances:\n  - region: us-east-1\n    instance: autotest-aurora-mysql-56\n    endpoint: %s\n"+
+		"discovery:\n  regions: [us-west-2]\n  endpoint: %s\n  interval: 50ms\n  instance_regex: autotest-mysql-57\n", fake.URL, fake.URL)
+	require.NoError(t, ioutil.WriteFile(r.filename, []byte(data), 0600))
+	require.NoError(t, r.reload())
+	defer r.runDiscoverer(nil)
+
+	discovered := func() bool {
+		s, _ := sess.GetSession("us-west-2", "autotest-mysql-57")
+		return s != nil
+	}
+	for i := 0; i < 100 && !discovered(); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	require.True(t, discovered())
+
+	// when discovered instances are forgotten, give a still running discoverer
+	// enough time to start the next run and wait for sessions update
+	var armed int32 = 1
+	sess.OnUpdate(func() {
+		if discovered() || !atomic.CompareAndSwapInt32(&armed, 1, 0) {
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+	})
+
+	write("autotest-aurora-mysql-56")
+	require.NoError(t, r.reload())
+	time.Sleep(200 * time.Millisecond)
+	assert.False(t, discovered())
+	assertInstances(t, sess, "autotest-aurora-mysql-56")
+}
@@ -0,0 +1,76 @@
+// Package sd implements Prometheus HTTP service discovery endpoint for monitored RDS instances.
+package sd
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/prometheus/common/log"
+
+	"github.com/percona/rds_exporter/sessions"
+)
+
+// TargetGroup is a single target group in Prometheus http_sd_config format.
+type TargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// Handler serves monitored instances as Prometheus http_sd_config JSON.
+// Each instance is a separate target group with "region/instance" target.
+type Handler struct {
+	sessions *sessions.Sessions
+	logger   log.Logger
+}
+
+// NewHandler creates a new Handler for given sessions.
+func NewHandler(sessions *sessions.Sessions) *Handler {
+	return &Handler{
+		sessions: sessions,
+		logger:   log.With("component", "sd"),
+	}
+}
+
+// TargetGroups returns target groups for all monitored instances sorted by target.
+func (h *Handler) TargetGroups() []TargetGroup {
+	res := []TargetGroup{}
+	for _, instances := range h.sessions.AllSessions() {
+		for _, instance := range instances {
+			labels := map[string]string{
+				"region":      instance.Region,
+				"instance":    instance.Instance,
+				"resource_id": instance.ResourceID,
+				"engine":      instance.Engine,
+			}
+			for n, v := range instance.AllLabels() {
+				if v == "" {
+					delete(labels, n)
+				} else {
+					labels[n] = v
+				}
+			}
+
+			res = append(res, TargetGroup{
+				Targets: []string{instance.Region + "/" + instance.Instance},
+				Labels:  labels,
+			})
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Targets[0] < res[j].Targets[0] })
+	return res
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(h.TargetGroups()); err != nil {
+		h.logger.Errorf("Failed to write response: %s.", err)
+	}
+}
+
+// check interfaces
+var (
+	_ http.Handler = (*Handler)(nil)
+)
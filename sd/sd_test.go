@@ -0,0 +1,65 @@
+package sd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/percona/rds_exporter/client"
+	"github.com/percona/rds_exporter/fakeaws"
+	"github.com/percona/rds_exporter/sessions"
+)
+
+func TestHandler(t *testing.T) {
+	cfg := fakeaws.New(t).LoadConfig(t, "../config.tests.yml")
+	cfg.Instances[1].Labels = map[string]string{"team": "db", "region": ""}
+	client := client.New()
+	sess, err := sessions.New(cfg.Instances, client.HTTP(), false)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	NewHandler(sess).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sd", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var actual []TargetGroup
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &actual))
+	expected := []TargetGroup{{
+		Targets: []string{"us-east-1/autotest-aurora-mysql-56"},
+		Labels: map[string]string{
+			"region":      "us-east-1",
+			"instance":    "autotest-aurora-mysql-56",
+			"resource_id": "db-OQT42DPIZWWQBVXQ2LH2BW3SV4",
+			"engine":      "aurora",
+		},
+	}, {
+		Targets: []string{"us-east-1/autotest-psql-10"},
+		Labels: map[string]string{
+			"instance":    "autotest-psql-10",
+			"resource_id": "db-PUZFCRUUHY365QFJLTOUWRDOCQ",
+			"engine":      "postgres",
+			"team":        "db",
+		},
+	}, {
+		Targets: []string{"us-west-2/autotest-aurora-psql-11"},
+		Labels: map[string]string{
+			"region":      "us-west-2",
+			"instance":    "autotest-aurora-psql-11",
+			"resource_id": "db-TYM5GWPPEMFCR5L6YX6ZBHUIUE",
+			"engine":      "aurora-postgresql",
+		},
+	}, {
+		Targets: []string{"us-west-2/autotest-mysql-57"},
+		Labels: map[string]string{
+			"region":      "us-west-2",
+			"instance":    "autotest-mysql-57",
+			"resource_id": "db-QXZYJIL5GR3CBQ4XNCYU2AI5PE",
+			"engine":      "mysql",
+		},
+	}}
+	assert.Equal(t, expected, actual)
+}
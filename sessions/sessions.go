@@ -1,9 +1,13 @@
 package sessions
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
+	"reflect"
+	"strings"
+	"sync"
 	"text/tabwriter"
 	"time"
 
@@ -12,6 +16,8 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/log"
 
 	"github.com/percona/rds_exporter/config"
@@ -24,8 +30,45 @@ type Instance struct {
 	DisableBasicMetrics        bool
 	DisableEnhancedMetrics     bool
 	ResourceID                 string
+	Engine                     string
 	Labels                     map[string]string
+	TagLabels                  []string          // RDS tag keys exposed as labels
+	Tags                       map[string]string // label name => value for allowed RDS tags
+	Metrics                    []config.Metric   // basic metrics configuration
 	EnhancedMonitoringInterval time.Duration
+	Info                       InstanceInfo
+}
+
+// AllLabels returns labels from allowed RDS tags and configuration file; the latter take precedence.
+// Empty values are kept to remove labels.
+func (i Instance) AllLabels() map[string]string {
+	if len(i.Tags) == 0 {
+		return i.Labels
+	}
+
+	res := make(map[string]string, len(i.Tags)+len(i.Labels))
+	for n, v := range i.Tags {
+		res[n] = v
+	}
+	for n, v := range i.Labels {
+		res[n] = v
+	}
+	return res
+}
+
+// InstanceInfo represents RDS instance metadata from DescribeDBInstances.
+type InstanceInfo struct {
+	EngineVersion         string
+	InstanceClass         string
+	AvailabilityZone      string
+	MultiAZ               bool
+	StorageType           string
+	ParameterGroup        string
+	AllocatedStorage      int64 // GiB
+	MaxAllocatedStorage   int64 // GiB, 0 if storage autoscaling is disabled
+	IOPS                  int64 // 0 if not provisioned
+	StorageThroughput     int64 // MiB/s, 0 if not provisioned
+	BackupRetentionPeriod int64 // days
 }
 
 func (i Instance) String() string {
@@ -37,138 +80,426 @@ func (i Instance) String() string {
 	return res
 }
 
+// Cluster represents a single Aurora DB cluster information in runtime.
+type Cluster struct {
+	Region  string
+	Cluster string
+	Labels  map[string]string
+	Metrics []config.Metric // basic metrics configuration
+}
+
+func (c Cluster) String() string {
+	return c.Region + "/cluster/" + c.Cluster
+}
+
 // Sessions is a pool of AWS sessions.
 type Sessions struct {
-	sessions map[*session.Session][]Instance
+	client *http.Client
+	trace  bool
+	logger log.Logger
+
+	updateM    sync.Mutex // serializes updates
+	rw         sync.RWMutex
+	instances  []config.Instance           // from configuration file
+	discovered []config.Instance           // from automatic discovery
+	shared     map[string]*session.Session // identity => session
+	sessions   map[*session.Session][]Instance
+	clusters   map[*session.Session][]Cluster
+	identities map[*session.Session]callerIdentity
+	onUpdate   []func()
+}
+
+// callerIdentity represents AWS account and ARN of session's credentials.
+type callerIdentity struct {
+	account string
+	arn     string
 }
 
+var sessionInfoDesc = prometheus.NewDesc(
+	"rds_exporter_session_info",
+	"AWS account and identity ARN used by the session.",
+	[]string{"region", "account", "arn"},
+	nil,
+)
+
 // New creates a new sessions pool for given configuration.
 func New(instances []config.Instance, client *http.Client, trace bool) (*Sessions, error) {
 	logger := log.With("component", "sessions")
 	logger.Info("Creating sessions...")
 	res := &Sessions{
-		sessions: make(map[*session.Session][]Instance),
+		client:     client,
+		trace:      trace,
+		logger:     logger,
+		instances:  instances,
+		shared:     make(map[string]*session.Session),
+		sessions:   make(map[*session.Session][]Instance),
+		clusters:   make(map[*session.Session][]Cluster),
+		identities: make(map[*session.Session]callerIdentity),
 	}
 
-	sharedSessions := make(map[string]*session.Session) // region/key => session
-	for _, instance := range instances {
-		// re-use session for the same region and key (explicit or empty for implicit) pair
-		if s := sharedSessions[instance.Region+"/"+instance.AWSAccessKey]; s != nil {
-			res.sessions[s] = append(res.sessions[s], Instance{
-				Region:                 instance.Region,
-				Instance:               instance.Instance,
-				Labels:                 instance.Labels,
-				DisableBasicMetrics:    instance.DisableBasicMetrics,
-				DisableEnhancedMetrics: instance.DisableEnhancedMetrics,
-			})
-			continue
+	if err := res.update(nil, nil); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// identity returns a key identifying region, endpoint and credentials of given instance.
+// Instances with the same identity share a single session.
+func identity(instance config.Instance) string {
+	c := instance.Credentials
+	return strings.Join([]string{
+		instance.Region, instance.Endpoint,
+		c.AWSAccessKey, c.AWSSecretKey, c.AWSProfile, c.AWSWebIdentityTokenFile,
+		strings.Join(c.Roles(), ","), c.AWSExternalID, c.AWSRoleSessionName,
+	}, "\x00")
+}
+
+// Update replaces instances from configuration file and updates sessions.
+// Sessions with unchanged credentials are re-used.
+// Instances are not changed if sessions can't be updated.
+func (s *Sessions) Update(instances []config.Instance) error {
+	if instances == nil {
+		instances = []config.Instance{}
+	}
+	return s.update(instances, nil)
+}
+
+// SetDiscovered replaces automatically discovered instances and updates sessions.
+// Instances from configuration file take precedence over discovered ones.
+func (s *Sessions) SetDiscovered(instances []config.Instance) error {
+	if instances == nil {
+		instances = []config.Instance{}
+	}
+	return s.update(nil, instances)
+}
+
+// Refresh re-resolves resource IDs, engines and enhanced monitoring intervals of all instances,
+// and picks up instances that were not resolved before.
+func (s *Sessions) Refresh() error {
+	return s.update(nil, nil)
+}
+
+// Run refreshes instances periodically until context is canceled.
+func (s *Sessions) Run(ctx context.Context, interval time.Duration) {
+	s.logger.Infof("Refreshing instances every %s.", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Refresh(); err != nil {
+				s.logger.Errorf("Failed to refresh sessions: %s.", err)
+			}
+		case <-ctx.Done():
+			return
 		}
+	}
+}
 
-		// use given credentials, or default credential chain
-		var creds *credentials.Credentials
+// OnUpdate registers a function that is called after the set of sessions or instances is changed.
+func (s *Sessions) OnUpdate(f func()) {
+	s.rw.Lock()
+	s.onUpdate = append(s.onUpdate, f)
+	s.rw.Unlock()
+}
 
-		creds, err := buildCredentials(instance)
+// update rebuilds sessions for given configured and discovered instances (nil means current ones),
+// re-using existing sessions where possible, and notifies subscribers if anything changed.
+// Given instances are stored only if sessions are updated successfully.
+func (s *Sessions) update(instances, discovered []config.Instance) error {
+	s.updateM.Lock()
+	defer s.updateM.Unlock()
 
-		if err != nil {
-			return nil, err
+	s.rw.RLock()
+	if instances == nil {
+		instances = s.instances
+	}
+	if discovered == nil {
+		discovered = s.discovered
+	}
+	all := make([]config.Instance, 0, len(instances)+len(discovered))
+	all = append(all, instances...)
+	seen := make(map[string]struct{}, len(instances))
+	for _, instance := range instances {
+		seen[instance.Region+"/"+instance.Instance] = struct{}{}
+	}
+	for _, instance := range discovered {
+		if _, ok := seen[instance.Region+"/"+instance.Instance]; ok {
+			continue
+		}
+		all = append(all, instance)
+	}
+	shared := make(map[string]*session.Session, len(s.shared))
+	for key, session := range s.shared {
+		shared[key] = session
+	}
+	identities := make(map[*session.Session]callerIdentity, len(s.identities))
+	for session, identity := range s.identities {
+		identities[session] = identity
+	}
+	previous := make(map[string]Instance)
+	for _, instances := range s.sessions {
+		for _, instance := range instances {
+			previous[instance.Region+"/"+instance.Instance] = instance
 		}
+	}
+	s.rw.RUnlock()
 
-		// make config with careful logging
-		awsCfg := &aws.Config{
-			Credentials: creds,
-			Region:      aws.String(instance.Region),
-			HTTPClient:  client,
+	sessions := make(map[*session.Session][]Instance)
+	clusters := make(map[*session.Session][]Cluster)
+	used := make(map[string]struct{})
+	for _, instance := range all {
+		// re-use session for the same region, endpoint and credentials
+		key := identity(instance)
+		session := shared[key]
+		if session == nil {
+			var err error
+			if session, err = NewSession(instance, s.client, s.trace); err != nil {
+				return err
+			}
+			shared[key] = session
 		}
-		if trace {
-			// fail-safe
-			if _, ok := os.LookupEnv("CI"); ok {
-				panic("Do not enable AWS request tracing on CI - output will contain credentials.")
+		if _, ok := identities[session]; !ok {
+			if identity, err := getCallerIdentity(session); err != nil {
+				s.logger.Errorf("Failed to get caller identity for %s: %s.", instance, err)
+			} else {
+				s.logger.Infof("Using AWS account %s (%s) for %s.", identity.account, identity.arn, instance)
+				identities[session] = identity
 			}
-
-			awsCfg.Logger = aws.LoggerFunc(logger.Debug)
-			awsCfg.CredentialsChainVerboseErrors = aws.Bool(true)
-			level := aws.LogDebugWithSigning | aws.LogDebugWithHTTPBody
-			level |= aws.LogDebugWithRequestRetries | aws.LogDebugWithRequestErrors | aws.LogDebugWithEventStreamBody
-			awsCfg.LogLevel = aws.LogLevel(level)
 		}
+		used[key] = struct{}{}
 
-		// store session
-		s, err := session.NewSession(awsCfg)
-		if err != nil {
-			return nil, err
+		if instance.Cluster != "" {
+			clusters[session] = append(clusters[session], Cluster{
+				Region:  instance.Region,
+				Cluster: instance.Cluster,
+				Labels:  instance.Labels,
+				Metrics: instance.Metrics,
+			})
+			continue
 		}
-		sharedSessions[instance.Region+"/"+instance.AWSAccessKey] = s
-		res.sessions[s] = append(res.sessions[s], Instance{
+		sessions[session] = append(sessions[session], Instance{
 			Region:                 instance.Region,
 			Instance:               instance.Instance,
 			Labels:                 instance.Labels,
+			TagLabels:              instance.TagLabels,
+			Metrics:                instance.Metrics,
 			DisableBasicMetrics:    instance.DisableBasicMetrics,
 			DisableEnhancedMetrics: instance.DisableEnhancedMetrics,
 		})
 	}
 
+	// forget sessions without instances
+	for key, session := range shared {
+		if _, ok := used[key]; !ok {
+			delete(shared, key)
+			delete(identities, session)
+		}
+	}
+
 	// add resource ID to all instances
-	for session, instances := range res.sessions {
-		svc := rds.New(session)
-		var marker *string
-		for {
-			output, err := svc.DescribeDBInstances(&rds.DescribeDBInstancesInput{
-				Marker: marker,
-			})
-			if err != nil {
-				logger.Errorf("Failed to get resource IDs: %s.", err)
-				break
-			}
+	for session, instances := range sessions {
+		if err := s.resolve(session, instances); err != nil {
+			s.logger.Errorf("Failed to get resource IDs: %s.", err)
 
-			for _, dbInstance := range output.DBInstances {
-				for i, instance := range instances {
-					if *dbInstance.DBInstanceIdentifier == instance.Instance {
-						instances[i].ResourceID = *dbInstance.DbiResourceId
-						instances[i].EnhancedMonitoringInterval = time.Duration(*dbInstance.MonitoringInterval) * time.Second
-					}
+			// keep previously resolved information
+			for i, instance := range instances {
+				if p, ok := previous[instance.Region+"/"+instance.Instance]; ok {
+					instances[i].ResourceID = p.ResourceID
+					instances[i].Engine = p.Engine
+					instances[i].EnhancedMonitoringInterval = p.EnhancedMonitoringInterval
+					instances[i].Info = p.Info
+					instances[i].Tags = p.Tags
 				}
 			}
-			if marker = output.Marker; marker == nil {
-				break
-			}
 		}
 	}
 
-	// remove instances without resource ID
-	for session, instances := range res.sessions {
+	// remove instances without resource ID and sessions without instances
+	for session, instances := range sessions {
 		newInstances := make([]Instance, 0, len(instances))
 		for _, instance := range instances {
 			if instance.ResourceID == "" {
-				logger.Errorf("Skipping %s - can't determine resourceID.", instance)
+				s.logger.Errorf("Skipping %s - can't determine resourceID.", instance)
 				continue
 			}
 			newInstances = append(newInstances, instance)
 		}
-		res.sessions[session] = newInstances
+		if len(newInstances) == 0 {
+			delete(sessions, session)
+			continue
+		}
+		sessions[session] = newInstances
 	}
 
-	// remove sessions without instances
-	for _, s := range sharedSessions {
-		if len(res.sessions[s]) == 0 {
-			delete(res.sessions, s)
-		}
+	s.rw.Lock()
+	changed := !reflect.DeepEqual(s.sessions, sessions) || !reflect.DeepEqual(s.clusters, clusters)
+	s.instances = instances
+	s.discovered = discovered
+	s.shared = shared
+	s.sessions = sessions
+	s.clusters = clusters
+	s.identities = identities
+	onUpdate := s.onUpdate
+	s.rw.Unlock()
+
+	if !changed {
+		return nil
 	}
 
 	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
-	fmt.Fprintf(w, "Region\tInstance\tResource ID\tInterval\n")
-	for _, instances := range res.sessions {
+	fmt.Fprintf(w, "Region\tInstance\tResource ID\tEngine\tInterval\tAccount\n")
+	for session, instances := range sessions {
 		for _, instance := range instances {
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", instance.Region, instance.Instance, instance.ResourceID, instance.EnhancedMonitoringInterval)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", instance.Region, instance.Instance, instance.ResourceID,
+				instance.Engine, instance.EnhancedMonitoringInterval, identities[session].account)
+		}
+	}
+	for session, clusters := range clusters {
+		for _, cluster := range clusters {
+			fmt.Fprintf(w, "%s\t%s\t\t\t\t%s\n", cluster.Region, "cluster/"+cluster.Cluster, identities[session].account)
 		}
 	}
 	_ = w.Flush()
 
-	logger.Infof("Using %d sessions.", len(res.sessions))
-	return res, nil
+	s.logger.Infof("Using %d sessions.", len(sessions))
+
+	for _, f := range onUpdate {
+		f()
+	}
+	return nil
+}
+
+// getCallerIdentity returns AWS account and ARN of given session's credentials.
+func getCallerIdentity(session *session.Session) (callerIdentity, error) {
+	output, err := sts.New(session).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return callerIdentity{}, err
+	}
+	return callerIdentity{
+		account: aws.StringValue(output.Account),
+		arn:     aws.StringValue(output.Arn),
+	}, nil
+}
+
+// resolve fills resource IDs and enhanced monitoring intervals for given instances sharing a single session.
+func (s *Sessions) resolve(session *session.Session, instances []Instance) error {
+	svc := rds.New(session)
+	var marker *string
+	for {
+		output, err := svc.DescribeDBInstances(&rds.DescribeDBInstancesInput{
+			Marker: marker,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, dbInstance := range output.DBInstances {
+			for i, instance := range instances {
+				if *dbInstance.DBInstanceIdentifier == instance.Instance {
+					instances[i].ResourceID = *dbInstance.DbiResourceId
+					instances[i].Engine = aws.StringValue(dbInstance.Engine)
+					instances[i].EnhancedMonitoringInterval = time.Duration(*dbInstance.MonitoringInterval) * time.Second
+					instances[i].Info = instanceInfo(dbInstance)
+					instances[i].Tags = tagLabels(dbInstance.TagList, instance.TagLabels)
+				}
+			}
+		}
+		if marker = output.Marker; marker == nil {
+			return nil
+		}
+	}
+}
+
+// instanceInfo returns metadata of given RDS instance.
+func instanceInfo(dbInstance *rds.DBInstance) InstanceInfo {
+	var parameterGroups []string
+	for _, pg := range dbInstance.DBParameterGroups {
+		parameterGroups = append(parameterGroups, aws.StringValue(pg.DBParameterGroupName))
+	}
+
+	return InstanceInfo{
+		EngineVersion:         aws.StringValue(dbInstance.EngineVersion),
+		InstanceClass:         aws.StringValue(dbInstance.DBInstanceClass),
+		AvailabilityZone:      aws.StringValue(dbInstance.AvailabilityZone),
+		MultiAZ:               aws.BoolValue(dbInstance.MultiAZ),
+		StorageType:           aws.StringValue(dbInstance.StorageType),
+		ParameterGroup:        strings.Join(parameterGroups, ","),
+		AllocatedStorage:      aws.Int64Value(dbInstance.AllocatedStorage),
+		MaxAllocatedStorage:   aws.Int64Value(dbInstance.MaxAllocatedStorage),
+		IOPS:                  aws.Int64Value(dbInstance.Iops),
+		StorageThroughput:     aws.Int64Value(dbInstance.StorageThroughput),
+		BackupRetentionPeriod: aws.Int64Value(dbInstance.BackupRetentionPeriod),
+	}
+}
+
+// tagLabels returns label names and values for allowed tag keys, or nil.
+// Label names are sanitized with config.TagLabelName.
+func tagLabels(tags []*rds.Tag, allowed []string) map[string]string {
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	values := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		values[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+
+	var res map[string]string
+	for _, key := range allowed {
+		value := values[key]
+		if value == "" {
+			continue
+		}
+
+		if res == nil {
+			res = make(map[string]string)
+		}
+		res[config.TagLabelName(key)] = value
+	}
+	return res
+}
+
+// NewSession creates a new AWS session for given instance's region and credentials.
+func NewSession(instance config.Instance, client *http.Client, trace bool) (*session.Session, error) {
+	// make config with careful logging
+	awsCfg := &aws.Config{
+		Region:     aws.String(instance.Region),
+		HTTPClient: client,
+	}
+	if instance.Endpoint != "" {
+		awsCfg.Endpoint = aws.String(instance.Endpoint)
+	}
+	if trace {
+		// fail-safe
+		if _, ok := os.LookupEnv("CI"); ok {
+			panic("Do not enable AWS request tracing on CI - output will contain credentials.")
+		}
+
+		awsCfg.Logger = aws.LoggerFunc(log.With("component", "sessions").Debug)
+		awsCfg.CredentialsChainVerboseErrors = aws.Bool(true)
+		level := aws.LogDebugWithSigning | aws.LogDebugWithHTTPBody
+		level |= aws.LogDebugWithRequestRetries | aws.LogDebugWithRequestErrors | aws.LogDebugWithEventStreamBody
+		awsCfg.LogLevel = aws.LogLevel(level)
+	}
+
+	// use given credentials, or default credential chain
+	creds, err := buildCredentials(instance.Credentials, awsCfg)
+	if err != nil {
+		return nil, err
+	}
+	awsCfg.Credentials = creds
+
+	return session.NewSession(awsCfg)
 }
 
 // GetSession returns session and full instance information for given region and instance.
 func (s *Sessions) GetSession(region, instance string) (*session.Session, *Instance) {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
 	for session, instances := range s.sessions {
 		for _, i := range instances {
 			if i.Region == region && i.Instance == instance {
@@ -179,30 +510,107 @@ func (s *Sessions) GetSession(region, instance string) (*session.Session, *Insta
 	return nil, nil
 }
 
-func buildCredentials(instance config.Instance) (*credentials.Credentials, error) {
-	if instance.AWSRoleArn != "" {
-		stsSession, err := session.NewSession(&aws.Config{
-			Region:      aws.String(instance.Region),
-			Credentials: credentials.NewStaticCredentials(instance.AWSAccessKey, instance.AWSSecretKey, ""),
-		})
+// buildCredentials returns credentials for given configuration, or nil for the default credential chain.
+// Base credentials (web identity, static keys, named profile, or default chain) are used to assume roles in order.
+func buildCredentials(c config.Credentials, awsCfg *aws.Config) (*credentials.Credentials, error) {
+	roles := c.Roles()
+
+	var creds *credentials.Credentials
+	switch {
+	case c.AWSWebIdentityTokenFile != "":
+		stsSession, err := session.NewSession(awsCfg)
 		if err != nil {
 			return nil, err
 		}
+		creds = stscreds.NewWebIdentityCredentials(stsSession, roles[0], c.AWSRoleSessionName, c.AWSWebIdentityTokenFile)
+		roles = roles[1:]
 
-		return stscreds.NewCredentials(stsSession, instance.AWSRoleArn), nil
-	}
-	if instance.AWSAccessKey != "" || instance.AWSSecretKey != "" {
-		return credentials.NewCredentials(&credentials.StaticProvider{
+	case c.AWSAccessKey != "" || c.AWSSecretKey != "":
+		creds = credentials.NewCredentials(&credentials.StaticProvider{
 			Value: credentials.Value{
-				AccessKeyID:     instance.AWSAccessKey,
-				SecretAccessKey: instance.AWSSecretKey,
+				AccessKeyID:     c.AWSAccessKey,
+				SecretAccessKey: c.AWSSecretKey,
 			},
-		}), nil
+		})
+
+	case c.AWSProfile != "":
+		profileSession, err := session.NewSessionWithOptions(session.Options{
+			Config:            *awsCfg,
+			Profile:           c.AWSProfile,
+			SharedConfigState: session.SharedConfigEnable,
+		})
+		if err != nil {
+			return nil, err
+		}
+		creds = profileSession.Config.Credentials
 	}
-	return nil, nil
+
+	for i, role := range roles {
+		stsSession, err := session.NewSession(awsCfg.Copy().WithCredentials(creds))
+		if err != nil {
+			return nil, err
+		}
+
+		last := i == len(roles)-1
+		creds = stscreds.NewCredentials(stsSession, role, func(p *stscreds.AssumeRoleProvider) {
+			p.RoleSessionName = c.AWSRoleSessionName
+			if last && c.AWSExternalID != "" {
+				p.ExternalID = aws.String(c.AWSExternalID)
+			}
+		})
+	}
+
+	return creds, nil
 }
 
 // AllSessions returns all sessions and instances.
 func (s *Sessions) AllSessions() map[*session.Session][]Instance {
-	return s.sessions
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	res := make(map[*session.Session][]Instance, len(s.sessions))
+	for session, instances := range s.sessions {
+		res[session] = instances
+	}
+	return res
+}
+
+// AllClusters returns all sessions and Aurora DB clusters.
+func (s *Sessions) AllClusters() map[*session.Session][]Cluster {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	res := make(map[*session.Session][]Cluster, len(s.clusters))
+	for session, clusters := range s.clusters {
+		res[session] = clusters
+	}
+	return res
 }
+
+// Describe implements prometheus.Collector.
+func (s *Sessions) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sessionInfoDesc
+}
+
+// Collect implements prometheus.Collector.
+func (s *Sessions) Collect(ch chan<- prometheus.Metric) {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	// different sessions (for example, with different endpoints or credentials of the same user)
+	// may have the same region and identity; report them once
+	seen := make(map[[3]string]struct{}, len(s.identities))
+	for session, identity := range s.identities {
+		labels := [3]string{aws.StringValue(session.Config.Region), identity.account, identity.arn}
+		if _, ok := seen[labels]; ok {
+			continue
+		}
+		seen[labels] = struct{}{}
+		ch <- prometheus.MustNewConstMetric(sessionInfoDesc, prometheus.GaugeValue, 1, labels[0], labels[1], labels[2])
+	}
+}
+
+// check interfaces
+var (
+	_ prometheus.Collector = (*Sessions)(nil)
+)
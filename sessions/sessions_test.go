@@ -2,16 +2,25 @@ package sessions
 
 import (
 	"flag"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/percona/exporter_shared/helpers"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/percona/rds_exporter/client"
 	"github.com/percona/rds_exporter/config"
+	"github.com/percona/rds_exporter/fakeaws"
 )
 
 var (
@@ -20,15 +29,11 @@ var (
 )
 
 func TestSession(t *testing.T) {
-	cfg, err := config.Load("../config.tests.yml")
-	require.NoError(t, err)
+	cfg := fakeaws.New(t).LoadConfig(t, "../config.tests.yml")
 
 	// set explicit keys to first instance to test grouping
-	cfg.Instances[0].AWSAccessKey = os.Getenv("AWS_ACCESS_KEY")
-	cfg.Instances[0].AWSSecretKey = os.Getenv("AWS_SECRET_KEY")
-	if cfg.Instances[0].AWSAccessKey == "" || cfg.Instances[0].AWSSecretKey == "" {
-		require.Fail(t, "AWS_ACCESS_KEY and AWS_SECRET_KEY environment variables must be set for this test")
-	}
+	cfg.Instances[0].AWSAccessKey = "AKIAEXPLICITFAKEKEY0"
+	cfg.Instances[0].AWSSecretKey = "fake"
 
 	client := client.New()
 	sessions, err := New(cfg.Instances, client.HTTP(), false)
@@ -57,25 +62,70 @@ func TestSession(t *testing.T) {
 		Region:                     "us-east-1",
 		Instance:                   "autotest-aurora-mysql-56",
 		ResourceID:                 "db-OQT42DPIZWWQBVXQ2LH2BW3SV4",
+		Engine:                     "aurora",
 		EnhancedMonitoringInterval: time.Minute,
+		Info: InstanceInfo{
+			EngineVersion:         "5.6.10a",
+			InstanceClass:         "db.t2.small",
+			AvailabilityZone:      "us-east-1a",
+			StorageType:           "aurora",
+			ParameterGroup:        "default.aurora5.6",
+			AllocatedStorage:      1,
+			BackupRetentionPeriod: 1,
+		},
 	}
 	p10iExpected := Instance{
 		Region:                     "us-east-1",
 		Instance:                   "autotest-psql-10",
 		ResourceID:                 "db-PUZFCRUUHY365QFJLTOUWRDOCQ",
+		Engine:                     "postgres",
 		EnhancedMonitoringInterval: time.Minute,
+		Info: InstanceInfo{
+			EngineVersion:         "10.6",
+			InstanceClass:         "db.t2.micro",
+			AvailabilityZone:      "us-east-1b",
+			StorageType:           "gp3",
+			ParameterGroup:        "default.postgres10",
+			AllocatedStorage:      100,
+			MaxAllocatedStorage:   1000,
+			IOPS:                  3000,
+			StorageThroughput:     125,
+			BackupRetentionPeriod: 7,
+		},
 	}
 	m57iExpected := Instance{
 		Region:                     "us-west-2",
 		Instance:                   "autotest-mysql-57",
 		ResourceID:                 "db-QXZYJIL5GR3CBQ4XNCYU2AI5PE",
+		Engine:                     "mysql",
 		EnhancedMonitoringInterval: time.Minute,
+		Info: InstanceInfo{
+			EngineVersion:         "5.7.22",
+			InstanceClass:         "db.t2.micro",
+			AvailabilityZone:      "us-west-2a",
+			MultiAZ:               true,
+			StorageType:           "io1",
+			ParameterGroup:        "default.mysql5.7",
+			AllocatedStorage:      100,
+			IOPS:                  1000,
+			BackupRetentionPeriod: 7,
+		},
 	}
 	ap11iExpected := Instance{
 		Region:                     "us-west-2",
 		Instance:                   "autotest-aurora-psql-11",
 		ResourceID:                 "db-TYM5GWPPEMFCR5L6YX6ZBHUIUE",
+		Engine:                     "aurora-postgresql",
 		EnhancedMonitoringInterval: time.Minute,
+		Info: InstanceInfo{
+			EngineVersion:         "11.6",
+			InstanceClass:         "db.r5.large",
+			AvailabilityZone:      "us-west-2b",
+			StorageType:           "aurora",
+			ParameterGroup:        "default.aurora-postgresql11",
+			AllocatedStorage:      1,
+			BackupRetentionPeriod: 1,
+		},
 	}
 
 	assert.Equal(t, &am56iExpected, am56i)
@@ -92,3 +142,295 @@ func TestSession(t *testing.T) {
 		// ap11s == m57s
 	}, all)
 }
+
+func TestSessionUpdate(t *testing.T) {
+	cfg := fakeaws.New(t).LoadConfig(t, "../config.tests.yml")
+
+	client := client.New()
+	sessions, err := New(cfg.Instances[:2], client.HTTP(), false)
+	require.NoError(t, err)
+
+	var updates int
+	sessions.OnUpdate(func() { updates++ })
+
+	s1, _ := sessions.GetSession("us-east-1", "autotest-aurora-mysql-56")
+	require.NotNil(t, s1)
+
+	// same instances - no changes
+	require.NoError(t, sessions.Update(cfg.Instances[:2]))
+	assert.Equal(t, 0, updates)
+
+	// new region - session for the old one is re-used
+	require.NoError(t, sessions.Update(cfg.Instances))
+	assert.Equal(t, 1, updates)
+	s2, _ := sessions.GetSession("us-east-1", "autotest-aurora-mysql-56")
+	assert.Same(t, s1, s2)
+	s3, i3 := sessions.GetSession("us-west-2", "autotest-mysql-57")
+	assert.NotNil(t, s3)
+	assert.Equal(t, "db-QXZYJIL5GR3CBQ4XNCYU2AI5PE", i3.ResourceID)
+
+	// changed credentials - session is re-created
+	cfg.Instances[0].AWSRoleArn = "arn:aws:iam::123456789012:role/fake"
+	require.NoError(t, sessions.Update(cfg.Instances))
+	assert.Equal(t, 2, updates)
+	s4, _ := sessions.GetSession("us-east-1", "autotest-aurora-mysql-56")
+	assert.NotSame(t, s1, s4)
+
+	// discovered instances do not override configured ones
+	discovered := cfg.Instances[3]
+	discovered.Labels = map[string]string{"discovered": "true"}
+	require.NoError(t, sessions.SetDiscovered([]config.Instance{discovered}))
+	_, i5 := sessions.GetSession("us-west-2", "autotest-aurora-psql-11")
+	assert.Nil(t, i5.Labels)
+
+	// removed instances
+	require.NoError(t, sessions.Update(nil))
+	s6, _ := sessions.GetSession("us-east-1", "autotest-aurora-mysql-56")
+	assert.Nil(t, s6)
+	_, i7 := sessions.GetSession("us-west-2", "autotest-aurora-psql-11")
+	assert.Equal(t, discovered.Labels, i7.Labels)
+}
+
+func TestSessionRefresh(t *testing.T) {
+	fake := fakeaws.New(t)
+	cfg := fake.LoadConfig(t, "../config.tests.yml")
+	cfg.Instances = append(cfg.Instances, config.Instance{
+		Region:   "us-east-1",
+		Instance: "autotest-creating",
+		Endpoint: fake.URL,
+	})
+
+	sessions, err := New(cfg.Instances, client.New().HTTP(), false)
+	require.NoError(t, err)
+	var updates int
+	sessions.OnUpdate(func() { updates++ })
+
+	// not resolved yet
+	s1, _ := sessions.GetSession("us-east-1", "autotest-creating")
+	assert.Nil(t, s1)
+
+	// no changes
+	require.NoError(t, sessions.Refresh())
+	assert.Equal(t, 0, updates)
+
+	// instance is created, another one is restored from snapshot with a new interval
+	fake.SetInstance(fakeaws.Instance{
+		Region:             "us-east-1",
+		Instance:           "autotest-creating",
+		ResourceID:         "db-CREATEDCREATEDCREATEDCRE",
+		Engine:             "mysql",
+		MonitoringInterval: 60,
+	})
+	fake.SetInstance(fakeaws.Instance{
+		Region:             "us-east-1",
+		Instance:           "autotest-psql-10",
+		ResourceID:         "db-RESTOREDRESTOREDRESTORED",
+		Engine:             "postgres",
+		MonitoringInterval: 5,
+	})
+	require.NoError(t, sessions.Refresh())
+	assert.Equal(t, 1, updates)
+
+	_, i2 := sessions.GetSession("us-east-1", "autotest-creating")
+	require.NotNil(t, i2)
+	assert.Equal(t, "db-CREATEDCREATEDCREATEDCRE", i2.ResourceID)
+	assert.Equal(t, time.Minute, i2.EnhancedMonitoringInterval)
+	_, i3 := sessions.GetSession("us-east-1", "autotest-psql-10")
+	require.NotNil(t, i3)
+	assert.Equal(t, "db-RESTOREDRESTOREDRESTORED", i3.ResourceID)
+	assert.Equal(t, 5*time.Second, i3.EnhancedMonitoringInterval)
+}
+
+func TestSessionTagLabels(t *testing.T) {
+	cfg := fakeaws.New(t).LoadConfig(t, "../config.tests.yml")
+	cfg.Instances[1].TagLabels = []string{"team", "cost-center", "Environment", "missing"}
+	cfg.Instances[1].Labels = map[string]string{"Environment": "", "foo": "bar"}
+
+	sessions, err := New(cfg.Instances, client.New().HTTP(), false)
+	require.NoError(t, err)
+
+	_, instance := sessions.GetSession("us-east-1", "autotest-psql-10")
+	require.NotNil(t, instance)
+	assert.Equal(t, map[string]string{"team": "dba", "cost_center": "42", "Environment": "test"}, instance.Tags)
+	assert.Equal(t, map[string]string{"team": "dba", "cost_center": "42", "Environment": "", "foo": "bar"}, instance.AllLabels())
+
+	// tags are not requested
+	_, instance = sessions.GetSession("us-east-1", "autotest-aurora-mysql-56")
+	require.NotNil(t, instance)
+	assert.Nil(t, instance.Tags)
+}
+
+func TestTagLabels(t *testing.T) {
+	tags := []*rds.Tag{
+		{Key: aws.String("team"), Value: aws.String("dba")},
+		{Key: aws.String("1st-line"), Value: aws.String("ops")},
+		{Key: aws.String("aws:cloudformation:stack-name"), Value: aws.String("rds")},
+		{Key: aws.String("empty"), Value: aws.String("")},
+	}
+	assert.Nil(t, tagLabels(tags, nil))
+	assert.Nil(t, tagLabels(tags, []string{"empty", "missing"}))
+	expected := map[string]string{
+		"team":                          "dba",
+		"_1st_line":                     "ops",
+		"aws_cloudformation_stack_name": "rds",
+	}
+	assert.Equal(t, expected, tagLabels(tags, []string{"team", "1st-line", "aws:cloudformation:stack-name", "empty"}))
+}
+
+func TestSessionRoles(t *testing.T) {
+	cfg := fakeaws.New(t).LoadConfig(t, "../config.tests.yml")
+
+	// same region, different roles in different accounts
+	first, second := cfg.Instances[0], cfg.Instances[1]
+	require.Equal(t, first.Region, second.Region)
+	first.AWSRoleArn = "arn:aws:iam::111111111111:role/rds"
+	second.AWSRoleArn = "arn:aws:iam::222222222222:role/rds"
+
+	sessions, err := New([]config.Instance{first, second}, client.New().HTTP(), false)
+	require.NoError(t, err)
+	s1, i1 := sessions.GetSession(first.Region, first.Instance)
+	s2, i2 := sessions.GetSession(second.Region, second.Instance)
+	require.NotNil(t, s1)
+	require.NotNil(t, s2)
+	assert.NotSame(t, s1, s2)
+	assert.Equal(t, "db-OQT42DPIZWWQBVXQ2LH2BW3SV4", i1.ResourceID)
+	assert.Equal(t, "db-PUZFCRUUHY365QFJLTOUWRDOCQ", i2.ResourceID)
+
+	// role session names are generated by SDK, so check only ARN prefixes
+	var actual []string
+	for _, m := range helpers.ReadMetrics(helpers.CollectMetrics(sessions)) {
+		account := m.Labels["account"]
+		assert.True(t, strings.HasPrefix(m.Labels["arn"], "arn:aws:sts::"+account+":assumed-role/rds/"), "%s", m.Labels["arn"])
+		actual = append(actual, m.Labels["region"]+" "+account)
+	}
+	sort.Strings(actual)
+	assert.Equal(t, []string{"us-east-1 111111111111", "us-east-1 222222222222"}, actual)
+}
+
+func TestSessionInfoDuplicates(t *testing.T) {
+	cfg := fakeaws.New(t).LoadConfig(t, "../config.tests.yml")
+
+	// same region and user, but different credentials
+	first, second := cfg.Instances[0], cfg.Instances[1]
+	require.Equal(t, first.Region, second.Region)
+	first.AWSAccessKey, first.AWSSecretKey = "AKIAFIRST", "first"
+	second.AWSAccessKey, second.AWSSecretKey = "AKIASECOND", "second"
+
+	sessions, err := New([]config.Instance{first, second}, client.New().HTTP(), false)
+	require.NoError(t, err)
+	s1, _ := sessions.GetSession(first.Region, first.Instance)
+	s2, _ := sessions.GetSession(second.Region, second.Instance)
+	assert.NotSame(t, s1, s2)
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(sessions)
+	mfs, err := registry.Gather()
+	require.NoError(t, err)
+	require.Len(t, mfs, 1)
+	assert.Len(t, mfs[0].GetMetric(), 1)
+}
+
+func TestBuildCredentials(t *testing.T) {
+	fake := fakeaws.New(t)
+
+	dir, err := ioutil.TempDir("", "rds_exporter_sessions")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	awsCfg := &aws.Config{
+		Region:     aws.String("us-east-1"),
+		Endpoint:   aws.String(fake.URL),
+		HTTPClient: client.New().HTTP(),
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		creds, err := buildCredentials(config.Credentials{}, awsCfg)
+		require.NoError(t, err)
+		assert.Nil(t, creds)
+	})
+
+	t.Run("WebIdentityRoleChain", func(t *testing.T) {
+		tokenFile := filepath.Join(dir, "token")
+		require.NoError(t, ioutil.WriteFile(tokenFile, []byte("fake-token"), 0600))
+
+		creds, err := buildCredentials(config.Credentials{
+			AWSWebIdentityTokenFile: tokenFile,
+			AWSRoleArn:              "arn:aws:iam::123456789012:role/first",
+			AWSRoleArns:             []string{"arn:aws:iam::210987654321:role/second"},
+			AWSExternalID:           "external",
+			AWSRoleSessionName:      "rds_exporter",
+		}, awsCfg)
+		require.NoError(t, err)
+		v, err := creds.Get()
+		require.NoError(t, err)
+		assert.Equal(t, "ASIAFAKE000000000001", v.AccessKeyID)
+
+		assert.Equal(t, 1, fake.Requests("AssumeRoleWithWebIdentity"))
+		p := fake.LastParams("AssumeRoleWithWebIdentity")
+		assert.Equal(t, "arn:aws:iam::123456789012:role/first", p.Get("RoleArn"))
+		assert.Equal(t, "rds_exporter", p.Get("RoleSessionName"))
+		assert.Equal(t, "fake-token", p.Get("WebIdentityToken"))
+
+		assert.Equal(t, 1, fake.Requests("AssumeRole"))
+		p = fake.LastParams("AssumeRole")
+		assert.Equal(t, "arn:aws:iam::210987654321:role/second", p.Get("RoleArn"))
+		assert.Equal(t, "rds_exporter", p.Get("RoleSessionName"))
+		assert.Equal(t, "external", p.Get("ExternalId"))
+	})
+
+	t.Run("Profile", func(t *testing.T) {
+		configFile := filepath.Join(dir, "config")
+		data := "[profile test]\naws_access_key_id = AKIAPROFILEFAKEFAKE0\naws_secret_access_key = fake\n"
+		require.NoError(t, ioutil.WriteFile(configFile, []byte(data), 0600))
+		prev, ok := os.LookupEnv("AWS_CONFIG_FILE")
+		require.NoError(t, os.Setenv("AWS_CONFIG_FILE", configFile))
+		defer func() {
+			if ok {
+				_ = os.Setenv("AWS_CONFIG_FILE", prev)
+			} else {
+				_ = os.Unsetenv("AWS_CONFIG_FILE")
+			}
+		}()
+
+		creds, err := buildCredentials(config.Credentials{AWSProfile: "test"}, awsCfg)
+		require.NoError(t, err)
+		v, err := creds.Get()
+		require.NoError(t, err)
+		assert.Equal(t, "AKIAPROFILEFAKEFAKE0", v.AccessKeyID)
+	})
+}
+
+func TestSessionUpdateFailure(t *testing.T) {
+	cfg := fakeaws.New(t).LoadConfig(t, "../config.tests.yml")
+	sessions, err := New(cfg.Instances[:1], client.New().HTTP(), false)
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "rds_exporter_sessions")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint:errcheck
+	prev, ok := os.LookupEnv("AWS_CONFIG_FILE")
+	configFile := filepath.Join(dir, "config")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte("[profile broken]\nrole_arn = arn:aws:iam::123456789012:role/rds\ncredential_source = Unknown\n"), 0600))
+	require.NoError(t, os.Setenv("AWS_CONFIG_FILE", configFile))
+	defer func() {
+		if ok {
+			_ = os.Setenv("AWS_CONFIG_FILE", prev)
+		} else {
+			_ = os.Unsetenv("AWS_CONFIG_FILE")
+		}
+	}()
+
+	// valid configuration with a broken profile
+	instances := cfg.Instances[:3]
+	instances[2].AWSProfile = "broken"
+	require.Error(t, sessions.Update(instances))
+
+	// old instances are kept, even after refresh
+	for _, err := range []error{nil, sessions.Refresh()} {
+		require.NoError(t, err)
+		s1, _ := sessions.GetSession("us-east-1", "autotest-aurora-mysql-56")
+		assert.NotNil(t, s1)
+		s2, _ := sessions.GetSession("us-east-1", "autotest-psql-10")
+		assert.Nil(t, s2)
+	}
+}